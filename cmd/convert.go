@@ -10,15 +10,23 @@ import (
 )
 
 var tplFile string
+var format string
 
 // convertCmd represents the convert command
 var convertCmd = &cobra.Command{
-	Use:   "convert [CSV file to convert]",
-	Short: "Convert a CSV file into Beancount (ledger like) format",
+	Use:   "convert [CSV, XLSX, ODS, OFX, CAMT, MT940 or QIF file to convert]",
+	Short: "Convert a CSV, XLSX, ODS, OFX, CAMT, MT940 or QIF file into Beancount (ledger like) format",
 	Long: `This command takes a CSV file, and a config file describing some important
 fields in that file, and then renders them in beancount (ledger like) format
 using a builtin default template, or one provided via the command line.
 
+A sheet of an Excel (xlsx) or OpenDocument (ods) spreadsheet is read like a
+CSV file, with the same config.
+
+OFX and QFX files, camt.053 or camt.052 XML files, MT940 or MT942 files and
+QIF files are read by their extension, or with --format, and their
+transactions are converted like the rows of a CSV file.
+
 This command does not alter any data in the file you provide, it simply reads
 the file, then uses a template to transform that data and render it to stdout.`,
 	Args: cobra.ExactArgs(1),
@@ -32,7 +40,7 @@ the file, then uses a template to transform that data and render it to stdout.`,
 			}).Fatal("error opening file")
 		}
 
-		internal.ProcessCsvFile(file, internal.GetConfig(), internal.GetTemplate(tplFile))
+		internal.ProcessFile(file, internal.GetFormat(args[0], format), internal.GetConfig(), internal.GetTemplate(tplFile))
 	},
 }
 
@@ -52,6 +60,7 @@ func init() {
 	// convertCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 
 	convertCmd.PersistentFlags().StringVar(&tplFile, "template", "", "custom template file (to override the internal default one)")
+	convertCmd.PersistentFlags().StringVar(&format, "format", "", "format of the file; csv, xlsx, ods, ofx, camt, mt940 or qif (default from the file extension, otherwise csv)")
 }
 
 // Typically this is in the root command, but since we don't actually
@@ -0,0 +1,8 @@
+{{.Date}} {{.Flag}} {{printf "%q" .Payee}} {{printf "%q" .Narration}}{{range .Tags}} #{{.}}{{end}}{{range .Links}} ^{{.}}{{end}}
+{{- range $key, $value := .Meta}}
+  {{$key}}: {{printf "%q" $value}}
+{{- end}}
+{{- range .Postings}}
+  {{.}}
+{{- end}}
+
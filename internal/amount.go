@@ -0,0 +1,362 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// The ways negative amounts are written
+const (
+	NegativeLeading     = "leading"     // -16,00
+	NegativeParentheses = "parentheses" // (16,00)
+	NegativeTrailing    = "trailing"    // 16,00-
+)
+
+// amountLocale holds the separators of a locale preset
+type amountLocale struct {
+	decimal   string // The decimal separator
+	thousands string // The thousands separator
+}
+
+// amountLocales are the locale presets, by language and optionally region
+var amountLocales = map[string]amountLocale{
+	"de":    {",", "."},
+	"de-at": {",", "."},
+	"de-ch": {".", "'"},
+	"en":    {".", ","},
+	"es":    {",", "."},
+	"fr":    {",", " "},
+	"fr-ch": {".", "'"},
+	"it":    {",", "."},
+	"it-ch": {".", "'"},
+	"nl":    {",", "."},
+	"pl":    {",", " "},
+	"pt":    {",", "."},
+	"sv":    {",", " "},
+}
+
+// getAmountLocale looks up a locale preset, e.g. de_DE or de-CH, falling
+// back to the language when there's no preset for the region
+func getAmountLocale(name string) (amountLocale, error) {
+	key := strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+
+	if locale, ok := amountLocales[key]; ok {
+		return locale, nil
+	}
+
+	if i := strings.Index(key, "-"); i >= 0 {
+		if locale, ok := amountLocales[key[:i]]; ok {
+			return locale, nil
+		}
+	}
+
+	return amountLocale{}, fmt.Errorf("unknown locale %q", name)
+}
+
+// amountSeparators returns the decimal and thousands separators, the
+// explicit settings taking precedence over the locale preset. An empty
+// decimal separator is detected from the amounts of the file.
+func amountSeparators(config CsvConfig) (decimal, thousands string, err error) {
+	if config.Locale != "" {
+		locale, err := getAmountLocale(config.Locale)
+		if err != nil {
+			return "", "", err
+		}
+
+		decimal, thousands = locale.decimal, locale.thousands
+	}
+
+	if config.DecimalSeparator != "" {
+		decimal = config.DecimalSeparator
+	}
+
+	if config.ThousandsSeparator != "" {
+		thousands = config.ThousandsSeparator
+	} else if thousands == decimal {
+		thousands = ""
+	}
+
+	return decimal, thousands, nil
+}
+
+// parseAmount parses an amount as written in the csv file, e.g. 1.234,56,
+// (12.00), 16,00- or € 12,00, into an exact decimal. Without a configured
+// decimal separator it's detected from the amount alone, so amounts of a
+// file are best parsed with the config returned by detectSeparators.
+func parseAmount(val string, config CsvConfig) (Decimal, error) {
+	str, negative, err := stripAmount(val, config)
+	if err != nil {
+		return Decimal{}, fmt.Errorf("invalid amount %q: %v", val, err)
+	}
+
+	decimal, thousands, err := amountSeparators(config)
+	if err != nil {
+		return Decimal{}, err
+	}
+
+	if decimal == "" {
+		if config, err = detectSeparators([]string{val}, config); err != nil {
+			return Decimal{}, err
+		}
+
+		decimal = config.DecimalSeparator
+	}
+
+	if thousands == "" && (decimal == "." || decimal == ",") {
+		thousands = strings.Trim(".,", decimal)
+	}
+
+	if err := checkAmountGroups(str, decimal, thousands); err != nil {
+		return Decimal{}, fmt.Errorf("invalid amount %q: %v", val, err)
+	}
+
+	if thousands != "" {
+		str = strings.ReplaceAll(str, thousands, "")
+	}
+
+	if decimal != "." {
+		if strings.Contains(str, ".") {
+			return Decimal{}, fmt.Errorf("invalid amount %q", val)
+		}
+
+		str = strings.ReplaceAll(str, decimal, ".")
+	}
+
+	amount, err := ParseDecimal(str)
+	if err != nil || strings.ContainsAny(str[:1], "+-") {
+		return Decimal{}, fmt.Errorf("invalid amount %q", val)
+	}
+
+	if negative {
+		amount = amount.Neg()
+	}
+
+	return amount, nil
+}
+
+// checkAmountGroups checks the separators of an amount before the thousands
+// separators are removed, so that an amount written with other separators
+// fails instead of being misread: there's at most one decimal separator, no
+// thousands separator after it, and three digits after each thousands one.
+func checkAmountGroups(str, decimal, thousands string) error {
+	if strings.Count(str, decimal) > 1 {
+		return fmt.Errorf("more than one decimal separator %q", decimal)
+	}
+
+	integer := str
+	if i := strings.Index(str, decimal); i >= 0 {
+		integer = str[:i]
+
+		if thousands != "" && strings.Contains(str[i:], thousands) {
+			return fmt.Errorf("thousands separator %q after the decimal separator %q", thousands, decimal)
+		}
+	}
+
+	if thousands == "" {
+		return nil
+	}
+
+	for _, group := range strings.Split(integer, thousands)[1:] {
+		if len(group) != 3 {
+			return fmt.Errorf("digit group %q after the thousands separator %q isn't three digits", group, thousands)
+		}
+	}
+
+	return nil
+}
+
+// stripAmount strips the symbols, spaces and sign from an amount, leaving
+// the digits and separators
+func stripAmount(val string, config CsvConfig) (string, bool, error) {
+	str := val
+
+	for _, symbol := range config.StripSymbols {
+		str = strings.ReplaceAll(str, symbol, "")
+	}
+
+	// spaces, including non-breaking ones, are never part of a number
+	str = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+
+		return r
+	}, str)
+
+	return parseAmountSign(str, config.NegativeStyle)
+}
+
+// parseAmountSign strips the sign from an amount, any style being accepted
+// when none is configured
+func parseAmountSign(str, style string) (string, bool, error) {
+	style = strings.ToLower(style)
+
+	switch style {
+	case "", NegativeLeading, NegativeParentheses, NegativeTrailing:
+	default:
+		return "", false, fmt.Errorf("unknown negative style %q", style)
+	}
+
+	accepts := func(s string) bool {
+		return style == "" || style == s
+	}
+
+	switch {
+	case accepts(NegativeParentheses) && strings.HasPrefix(str, "(") && strings.HasSuffix(str, ")"):
+		return str[1 : len(str)-1], true, nil
+	case accepts(NegativeTrailing) && strings.HasSuffix(str, "-"):
+		return str[:len(str)-1], true, nil
+	case accepts(NegativeTrailing) && strings.HasSuffix(str, "+"):
+		return str[:len(str)-1], false, nil
+	case accepts(NegativeLeading) && strings.HasPrefix(str, "-"):
+		return str[1:], true, nil
+	case strings.HasPrefix(str, "+"):
+		return str[1:], false, nil
+	}
+
+	return str, false, nil
+}
+
+// detectSeparators detects the decimal separator of the amounts of a file
+// when it isn't configured, returning the config with it set. An amount
+// shows the decimal separator when it has both a dot and a comma, the last
+// one being the decimal separator, when a separator appears more than once,
+// which makes it the thousands separator, or when a lone separator isn't
+// followed by exactly three digits. A lone separator followed by three
+// digits, as in 1,234 or 1.234, fits both readings and is read the way the
+// other amounts show, it's an error if none of them does.
+func detectSeparators(values []string, config CsvConfig) (CsvConfig, error) {
+	decimal, _, err := amountSeparators(config)
+	if err != nil || decimal != "" {
+		return config, err
+	}
+
+	// an amount showing each decimal separator, and one fitting both
+	shown := make(map[string]string)
+	var ambiguous string
+
+	for _, val := range values {
+		str, _, err := stripAmount(val, config)
+		if err != nil {
+			continue
+		}
+
+		switch decimal := amountDecimalSeparator(str); {
+		case decimal != "":
+			shown[decimal] = val
+		case strings.ContainsAny(str, ".,") && ambiguous == "":
+			ambiguous = val
+		}
+	}
+
+	switch {
+	case len(shown) > 1:
+		return config, fmt.Errorf("amounts %q and %q have different decimal separators", shown["."], shown[","])
+	case len(shown) == 1:
+		for decimal := range shown {
+			config.DecimalSeparator = decimal
+		}
+	case ambiguous != "":
+		return config, fmt.Errorf("amount %q can be read with either a dot or a comma as the decimal separator, configure the decimal_separator or the locale", ambiguous)
+	default:
+		config.DecimalSeparator = "."
+	}
+
+	return config, nil
+}
+
+// amountDecimalSeparator returns the decimal separator an amount shows, an
+// empty string if it has no separator or fits both readings
+func amountDecimalSeparator(str string) string {
+	dot, comma := strings.LastIndex(str, "."), strings.LastIndex(str, ",")
+
+	switch {
+	case dot >= 0 && comma >= 0 && comma > dot:
+		return ","
+	case dot >= 0 && comma >= 0:
+		return "."
+	case dot < 0 && comma < 0:
+		return ""
+	}
+
+	separator, i := ".", dot
+	if comma >= 0 {
+		separator, i = ",", comma
+	}
+
+	switch {
+	case strings.Count(str, separator) > 1:
+		return strings.Trim(".,", separator)
+	case len(str)-i-1 != 3 || strings.Trim(str[:i], "0") == "":
+		return separator
+	}
+
+	return ""
+}
+
+// amountValues returns the values of the amount fields of a record, which
+// the separators of the file are detected from
+func (c CsvConfig) amountValues(record []string) []string {
+	columns := []*Column{&c.AmountIn, &c.AmountOut, c.Balance, c.OriginalAmount}
+
+	for _, fees := range [][]Fee{c.Fees, c.Taxes} {
+		for i := range fees {
+			columns = append(columns, &fees[i].Column)
+		}
+	}
+
+	for _, m := range c.Postings {
+		columns = append(columns, m.Column)
+	}
+
+	if c.Brokerage != nil {
+		columns = append(columns, &c.Brokerage.Price, &c.Brokerage.Quantity, c.Brokerage.Value)
+	}
+
+	if c.Exchange != nil {
+		columns = append(columns, &c.Exchange.Price, &c.Exchange.Quantity, c.Exchange.Fee, c.Exchange.FeeValue, c.Exchange.Value)
+	}
+
+	var values []string
+
+	for _, column := range columns {
+		if value := column.value(record); strings.TrimSpace(value) != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// The indicator values used when none are configured, compared ignoring case
+var (
+	IndicatorCreditValues = []string{"H", "Haben", "CR", "C", "Credit"}
+	IndicatorDebitValues  = []string{"S", "Soll", "DR", "D", "Debit"}
+)
+
+// applyIndicator signs an amount by the value of the indicator column,
+// negative for a debit and positive for a credit, whatever sign the amount
+// itself is written with
+func applyIndicator(amount Decimal, value string, config CsvConfig) (Decimal, error) {
+	debit, credit := config.IndicatorDebit, config.IndicatorCredit
+	if len(debit) == 0 && len(credit) == 0 {
+		debit, credit = IndicatorDebitValues, IndicatorCreditValues
+	}
+
+	value = strings.TrimSpace(value)
+
+	for _, v := range debit {
+		if strings.EqualFold(value, v) {
+			return amount.Abs().Neg(), nil
+		}
+	}
+
+	for _, v := range credit {
+		if strings.EqualFold(value, v) {
+			return amount.Abs(), nil
+		}
+	}
+
+	return amount, fmt.Errorf("unknown indicator %q, expected one of %v or %v", value, debit, credit)
+}
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	var tests = []struct {
+		input  string
+		config CsvConfig
+		want   string
+	}{
+		{"6,09", CsvConfig{}, "6.09"},
+		{"20,82", CsvConfig{}, "20.82"},
+		{"100,27", CsvConfig{}, "100.27"},
+		{"1.344,01", CsvConfig{}, "1344.01"},
+		{"-16,00", CsvConfig{}, "-16.00"},
+		{"1.234,5", CsvConfig{}, "1234.5"},
+		{"1,234.56", CsvConfig{}, "1234.56"},
+		{"1.234.567", CsvConfig{}, "1234567"},
+		{"(12.00)", CsvConfig{}, "-12.00"},
+		{"16,00-", CsvConfig{}, "-16.00"},
+		{"16,00+", CsvConfig{}, "16.00"},
+		{"+16,00", CsvConfig{}, "16.00"},
+		{"1 234,56", CsvConfig{}, "1234.56"},
+		{"€ 12,00", CsvConfig{StripSymbols: []string{"€"}}, "12.00"},
+		{"-12,00 EUR", CsvConfig{StripSymbols: []string{"EUR"}}, "-12.00"},
+		{"1.234", CsvConfig{DecimalSeparator: ","}, "1234"},
+		{"1,234", CsvConfig{DecimalSeparator: ","}, "1.234"},
+		{"1'234.50", CsvConfig{Locale: "de_CH"}, "1234.50"},
+		{"1 234,50", CsvConfig{Locale: "fr-FR"}, "1234.50"},
+		{"1.234,50", CsvConfig{Locale: "de_DE"}, "1234.50"},
+		{"1,234", CsvConfig{Locale: "de", DecimalSeparator: "."}, "1234"},
+		{"16,00-", CsvConfig{NegativeStyle: "trailing"}, "-16.00"},
+		{"(16,00)", CsvConfig{NegativeStyle: "Parentheses"}, "-16.00"},
+	}
+
+	for _, tt := range tests {
+		testname := fmt.Sprintf("input: '%s', want: '%s'", tt.input, tt.want)
+		t.Run(testname, func(t *testing.T) {
+			ans, err := parseAmount(tt.input, tt.config)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			if ans.String() != tt.want {
+				t.Errorf("got '%s', want '%s'", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAmountErrors(t *testing.T) {
+	var tests = []struct {
+		input  string
+		config CsvConfig
+	}{
+		{"", CsvConfig{}},
+		{"--16,00", CsvConfig{}},
+		{"-16,00-", CsvConfig{}},
+		{"€ 12,00", CsvConfig{}},
+		{"n/a", CsvConfig{}},
+		{"1,234", CsvConfig{}},
+		{"1.234", CsvConfig{}},
+		{"1,234,56", CsvConfig{DecimalSeparator: ","}},
+		{"1,234.56", CsvConfig{Locale: "de"}},
+		{"1.234,56", CsvConfig{DecimalSeparator: "."}},
+		{"1.23,4", CsvConfig{}},
+		{"1.23,4", CsvConfig{DecimalSeparator: ","}},
+		{"1,2,3", CsvConfig{}},
+		{"1,2,3", CsvConfig{DecimalSeparator: "."}},
+		{"1,2,3", CsvConfig{DecimalSeparator: ","}},
+		{"-16,00", CsvConfig{NegativeStyle: "trailing"}},
+		{"(16,00)", CsvConfig{NegativeStyle: "leading"}},
+		{"16,00", CsvConfig{NegativeStyle: "suffix"}},
+		{"16,00", CsvConfig{Locale: "xx"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if ans, err := parseAmount(tt.input, tt.config); err == nil {
+				t.Errorf("got %s, want an error", ans)
+			}
+		})
+	}
+}
+
+func TestDetectSeparators(t *testing.T) {
+	var tests = []struct {
+		name   string
+		values []string
+		config CsvConfig
+		want   string
+		err    bool
+	}{
+		{"comma", []string{"1,234", "-16,00", "3.784,22"}, CsvConfig{}, ",", false},
+		{"dot", []string{"1,234", "1.234", "-16.5"}, CsvConfig{}, ".", false},
+		{"thousands", []string{"1.234", "1.234.567"}, CsvConfig{}, ",", false},
+		{"leading zero", []string{"0,125", "1,234"}, CsvConfig{}, ",", false},
+		{"whole amounts", []string{"16", "-1234", ""}, CsvConfig{}, ".", false},
+		{"configured", []string{"1,234"}, CsvConfig{DecimalSeparator: ","}, ",", false},
+		{"locale", []string{"1,234"}, CsvConfig{Locale: "en_US"}, "", false},
+		{"ambiguous", []string{"1,234", "16"}, CsvConfig{}, "", true},
+		{"different", []string{"1.234,56", "1,234.56"}, CsvConfig{}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ans, err := detectSeparators(tt.values, tt.config)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+
+			if err == nil && ans.DecimalSeparator != tt.want {
+				t.Errorf("got %q, want %q", ans.DecimalSeparator, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyIndicator(t *testing.T) {
+	var tests = []struct {
+		amount string
+		value  string
+		config CsvConfig
+		want   string
+		err    bool
+	}{
+		{"16.00", "S", CsvConfig{}, "-16.00", false},
+		{"16.00", "H", CsvConfig{}, "16.00", false},
+		{"16.00", " dr ", CsvConfig{}, "-16.00", false},
+		{"-16.00", "Credit", CsvConfig{}, "16.00", false},
+		{"16.00", "X", CsvConfig{}, "", true},
+		{"16.00", "Lastschrift", CsvConfig{IndicatorDebit: []string{"Lastschrift"}, IndicatorCredit: []string{"Gutschrift"}}, "-16.00", false},
+		{"16.00", "S", CsvConfig{IndicatorDebit: []string{"Lastschrift"}, IndicatorCredit: []string{"Gutschrift"}}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount+" "+tt.value, func(t *testing.T) {
+			ans, err := applyIndicator(mustDecimal(tt.amount), tt.value, tt.config)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+
+			if err == nil && ans.String() != tt.want {
+				t.Errorf("got %s, want %s", ans, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"io"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// BalanceAssertionsDaily asserts the balance after the last record of each day
+	BalanceAssertionsDaily = "daily"
+	// BalanceAssertionsEnd asserts the balance once, after the last record
+	BalanceAssertionsEnd = "end"
+)
+
+// Balance represents a balance assertion
+type Balance struct {
+	Account  string  // The account to assert the balance of
+	Amount   Decimal // The expected balance
+	Currency string  // The currency
+	Date     string  // The date, a day after the record the balance was taken from
+}
+
+// BalanceTemplate is the template for formatting balance assertions
+const BalanceTemplate = `{{.Date}} balance {{.Account}}  {{.Amount}} {{.Currency}}
+
+`
+
+// getBalances works out the balance assertions for the records, keyed by
+// the index of the record they are to be rendered after. Records may be in
+// either ascending or descending date order, but either way the balance of
+// a day is taken from the chronologically last record of that day.
+func getBalances(records []Record, config CsvConfig) map[int]Balance {
+	balances := make(map[int]Balance)
+
+	if config.Balance == nil || len(records) == 0 {
+		return balances
+	}
+
+	descending := records[0].time.After(records[len(records)-1].time)
+
+	// latest picks the chronologically last record of records[start:end]
+	latest := func(start, end int) Record {
+		if descending {
+			return records[start]
+		}
+		return records[end-1]
+	}
+
+	switch config.BalanceAssertions {
+	case BalanceAssertionsDaily:
+		start := 0
+		for i := range records {
+			if i+1 < len(records) && records[i+1].time.Equal(records[i].time) {
+				continue
+			}
+
+			if balance, ok := getBalance(latest(start, i+1), config); ok {
+				balances[i] = balance
+			}
+
+			start = i + 1
+		}
+	case BalanceAssertionsEnd, "":
+		if balance, ok := getBalance(latest(0, len(records)), config); ok {
+			balances[len(records)-1] = balance
+		}
+	default:
+		log.WithFields(log.Fields{
+			"balance_assertions": config.BalanceAssertions,
+		}).Fatal("unknown balance assertions setting")
+	}
+
+	return balances
+}
+
+// getBalance returns the balance assertion for a record, dated the day
+// after the record since beancount checks balances at the start of the day
+func getBalance(record Record, config CsvConfig) (Balance, bool) {
+	if record.balance == nil || record.time.IsZero() {
+		return Balance{}, false
+	}
+
+	return Balance{
+		Account:  config.ProcessingAccount,
+		Amount:   *record.balance,
+		Currency: record.Currency,
+		Date:     record.time.AddDate(0, 0, 1).Format(config.DateLayoutOut),
+	}, true
+}
+
+// renderBalance ...
+func renderBalance(balance Balance, output io.Writer) {
+	t := template.Must(template.New("balance").Parse(BalanceTemplate))
+
+	err := t.Execute(output, balance)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("error executing balance template")
+	}
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProcessCsvFileBalances(t *testing.T) {
+	ascending := `Buchung;Saldo;Betrag
+23.04.2019;1.883,75;-18,99
+23.04.2019;1.877,17;-6,58
+24.04.2019;6.839,05;-27,00
+`
+
+	var tests = []struct {
+		name string
+		file string
+		mode string
+		want string
+	}{
+		{
+			"test #1 descending file, end of file",
+			INGDiBaCsvFile,
+			BalanceAssertionsEnd,
+			`2019-04-26 Acme Corp GmbH
+2019-04-24 VISA RYANAIR
+2019-04-24 VISA BLOCK HOUSE 1133
+2019-04-23 VISA CAR2GO DEUTSCHLAND GMB
+2019-04-23 VISA REWE MARKT GMBH-ZWNL O
+2019-04-23 VISA DUSSMANN D.KULTURKAUFH
+2019-04-27 balance Assets:Unknown  12604.42 EUR
+
+`,
+		},
+		{
+			"test #2 descending file, daily",
+			INGDiBaCsvFile,
+			BalanceAssertionsDaily,
+			`2019-04-26 Acme Corp GmbH
+2019-04-27 balance Assets:Unknown  12604.42 EUR
+
+2019-04-24 VISA RYANAIR
+2019-04-24 VISA BLOCK HOUSE 1133
+2019-04-25 balance Assets:Unknown  6823.05 EUR
+
+2019-04-23 VISA CAR2GO DEUTSCHLAND GMB
+2019-04-23 VISA REWE MARKT GMBH-ZWNL O
+2019-04-23 VISA DUSSMANN D.KULTURKAUFH
+2019-04-24 balance Assets:Unknown  1864.95 EUR
+
+`,
+		},
+		{
+			"test #3 ascending file, daily",
+			ascending,
+			BalanceAssertionsDaily,
+			`2019-04-23 
+2019-04-23 
+2019-04-24 balance Assets:Unknown  1877.17 EUR
+
+2019-04-24 
+2019-04-25 balance Assets:Unknown  6839.05 EUR
+
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfigExample1
+			config.Csv.Skip = 0
+			config.Csv.SkipUntil = "^Buchung;"
+			config.Csv.Balance = &Column{Index: -1, Name: "Saldo"}
+			config.Csv.BalanceAssertions = tt.mode
+			config.Csv.AmountIn = Column{Index: -1, Name: "Betrag"}
+			config.Csv.AmountOut = config.Csv.AmountIn
+			config.Csv.Payee = Column{Index: -1}
+			if tt.file == INGDiBaCsvFile {
+				config.Csv.Payee = Column{Index: 2}
+			}
+			config.TransactionsRules = TransactionsRulesConfig{}
+
+			buf := new(bytes.Buffer)
+			processCsvFile(strings.NewReader(tt.file), config, "{{.Date}} {{.Payee}}\n", buf)
+
+			if buf.String() != tt.want {
+				t.Errorf("got %v, want %v", buf.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// The ways sells are booked against the lots they reduce
+const (
+	BookingEmpty = "empty" // An empty cost specification, leaving it to beancount's booking method
+	BookingFIFO  = "fifo"  // The lots bought first in the file, with their cost and date
+)
+
+// BrokerageConfig is the config for converting broker csv files, which have
+// a trade of a security on each row
+type BrokerageConfig struct {
+	Action          *Column  // The buy/sell field, the sign of the quantity is used if not set
+	Booking         string   // How sells are booked against lots; empty or fifo
+	Buy             []string // The action values of buys
+	CashAccount     string   // The account of the cash leg, the processing account if empty
+	GainsAccount    string   // The account of the capital gains of sells
+	HoldingsAccount string   // The account of the units, {symbol} is replaced by the symbol
+	Price           Column   // The price per unit field
+	Quantity        Column   // The number of units field
+	Sell            []string // The action values of sells
+	Symbol          Column   // The symbol field
+	Value           *Column  // The value of the units field, before fees, the quantity times the price if not set
+}
+
+// getBrokerage reads the brokerage config, nil if it isn't configured
+func getBrokerage() *BrokerageConfig {
+	if !viper.IsSet("csv.brokerage") {
+		return nil
+	}
+
+	brokerage := &BrokerageConfig{
+		Action:          getOptionalColumn("csv.brokerage.action"),
+		Booking:         strings.ToLower(viper.GetString("csv.brokerage.booking")),
+		Buy:             viper.GetStringSlice("csv.brokerage.buy"),
+		CashAccount:     viper.GetString("csv.brokerage.cash_account"),
+		GainsAccount:    viper.GetString("csv.brokerage.gains_account"),
+		HoldingsAccount: viper.GetString("csv.brokerage.holdings_account"),
+		Price:           getColumn("csv.brokerage.price"),
+		Quantity:        getColumn("csv.brokerage.quantity"),
+		Sell:            viper.GetStringSlice("csv.brokerage.sell"),
+		Symbol:          getColumn("csv.brokerage.symbol"),
+		Value:           getOptionalColumn("csv.brokerage.value"),
+	}
+
+	if brokerage.Booking == "" {
+		brokerage.Booking = BookingEmpty
+	}
+
+	if len(brokerage.Buy) == 0 {
+		brokerage.Buy = []string{"buy", "kauf"}
+	}
+
+	if len(brokerage.Sell) == 0 {
+		brokerage.Sell = []string{"sell", "verkauf"}
+	}
+
+	if brokerage.GainsAccount == "" {
+		brokerage.GainsAccount = "Income:Capital-Gains"
+	}
+
+	if brokerage.HoldingsAccount == "" {
+		brokerage.HoldingsAccount = "Assets:Broker:{symbol}"
+	}
+
+	switch brokerage.Booking {
+	case BookingEmpty, BookingFIFO:
+	default:
+		log.WithFields(log.Fields{
+			"booking": brokerage.Booking,
+		}).Fatal("unknown brokerage booking setting")
+	}
+
+	return brokerage
+}
+
+// trade is a buy or a sell of a security
+type trade struct {
+	account  string  // The holdings account
+	currency string  // The currency of the price
+	price    Decimal // The price per unit
+	quantity Decimal // The number of units, negative for sells
+	symbol   string  // The commodity of the units
+	value    Decimal // The value of the units, before fees
+}
+
+// getTrade reads the trade of a record, nil if the record isn't a buy or a
+// sell so it can be converted from its amount like any other record
+func getTrade(record []string, config CsvConfig, currency string) (*trade, error) {
+	brokerage := config.Brokerage
+
+	sign := 0
+
+	if brokerage.Action != nil {
+		action := strings.TrimSpace(brokerage.Action.value(record))
+
+		switch {
+		case containsFold(brokerage.Buy, action):
+			sign = 1
+		case containsFold(brokerage.Sell, action):
+			sign = -1
+		default:
+			return nil, nil
+		}
+	}
+
+	value := brokerage.Quantity.value(record)
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	quantity, err := parseAmount(value, config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quantity: %v", err)
+	}
+
+	switch sign {
+	case 1:
+		quantity = quantity.Abs()
+	case -1:
+		quantity = quantity.Abs().Neg()
+	}
+
+	if quantity.IsZero() {
+		return nil, nil
+	}
+
+	price, err := parseAmount(brokerage.Price.value(record), config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price: %v", err)
+	}
+
+	symbol := normalizeCommodity(brokerage.Symbol.value(record), config)
+	if symbol == "" {
+		return nil, fmt.Errorf("missing symbol")
+	}
+
+	total := quantity.Abs().Mul(price.Abs())
+	if value := brokerage.Value.value(record); strings.TrimSpace(value) != "" {
+		if total, err = parseAmount(value, config); err != nil {
+			return nil, fmt.Errorf("invalid value: %v", err)
+		}
+	}
+
+	return &trade{
+		account:  strings.ReplaceAll(brokerage.HoldingsAccount, "{symbol}", symbol),
+		currency: currency,
+		price:    price.Abs(),
+		quantity: quantity,
+		symbol:   symbol,
+		value:    total.Abs(),
+	}, nil
+}
+
+// containsFold reports whether the values contain the value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cash returns the cash leg of the trade, fees included
+func (t trade) cash(fees Decimal) Decimal {
+	if t.quantity.Sign() > 0 {
+		return t.value.Neg().Sub(fees)
+	}
+
+	return t.value.Sub(fees)
+}
+
+// postings returns the postings of the trade: the units at cost, the fees,
+// the cash leg and for sells the capital gains, which are left for beancount
+// to interpolate until the sell is booked against its lots
+func (t trade) postings(fees []Posting, charged Decimal, config CsvConfig) []Posting {
+	quantity := t.quantity
+	units := Posting{Account: t.account, Amount: &quantity, Commodity: t.symbol}
+
+	if quantity.Sign() > 0 {
+		price := t.price
+		units.Cost = &Cost{Amount: &price, Commodity: t.currency}
+	} else {
+		units.Cost = &Cost{}
+		units.Price = &Price{Amount: t.price, Commodity: t.currency}
+	}
+
+	account := config.Brokerage.CashAccount
+	if account == "" {
+		account = config.ProcessingAccount
+	}
+
+	cash := t.cash(charged)
+
+	postings := append(append([]Posting{units}, fees...), Posting{Account: account, Amount: &cash, Commodity: t.currency})
+
+	if quantity.Sign() < 0 {
+		postings = append(postings, Posting{Account: config.Brokerage.GainsAccount, Commodity: t.currency})
+	}
+
+	return postings
+}
+
+// lot is a number of units bought at the same cost
+type lot struct {
+	cost     Decimal // The cost per unit
+	date     string  // The date the units were bought
+	quantity Decimal // The number of units left
+}
+
+// bookLots books the sells against the lots bought earlier in the file,
+// first in first out, giving each reduced lot its own posting with its cost
+// and date, and the capital gains an exact amount. Sells of more units than
+// were bought in the file keep their empty cost specification.
+func bookLots(records []Record) {
+	order := make([]int, len(records))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return records[order[a]].time.Before(records[order[b]].time)
+	})
+
+	lots := make(map[string][]lot)
+
+	for _, i := range order {
+		record := &records[i]
+		t := record.trade
+
+		if t == nil {
+			continue
+		}
+
+		key := t.account + " " + t.symbol
+
+		if t.quantity.Sign() > 0 {
+			lots[key] = append(lots[key], lot{t.price, record.time.Format("2006-01-02"), t.quantity})
+
+			continue
+		}
+
+		var available Decimal
+		for _, l := range lots[key] {
+			available = available.Add(l.quantity)
+		}
+
+		if available.Cmp(t.quantity.Abs()) < 0 {
+			log.WithFields(log.Fields{
+				"symbol":    t.symbol,
+				"date":      record.Date,
+				"quantity":  t.quantity.Abs(),
+				"available": available,
+			}).Warn("selling more units than were bought in the file, leaving them to beancount's booking")
+
+			continue
+		}
+
+		var postings []Posting
+		var basis Decimal
+
+		remaining := t.quantity.Abs()
+
+		for remaining.Sign() > 0 {
+			l := &lots[key][0]
+
+			take := l.quantity
+			if take.Cmp(remaining) > 0 {
+				take = remaining
+			}
+
+			quantity, cost := take.Neg(), l.cost
+			postings = append(postings, Posting{
+				Account:   t.account,
+				Amount:    &quantity,
+				Commodity: t.symbol,
+				Cost:      &Cost{Amount: &cost, Commodity: t.currency, Date: l.date},
+				Price:     &Price{Amount: t.price, Commodity: t.currency},
+			})
+
+			basis = basis.Add(take.Mul(cost))
+			remaining = remaining.Sub(take)
+
+			if l.quantity = l.quantity.Sub(take); l.quantity.IsZero() {
+				lots[key] = lots[key][1:]
+			}
+		}
+
+		// the units posting comes first and the gains posting last
+		gains := basis.Sub(t.value)
+		record.Postings[len(record.Postings)-1].Amount = &gains
+		record.Postings = append(postings, record.Postings[1:]...)
+	}
+}
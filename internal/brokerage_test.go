@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const brokerageCsvFile = `Date;Type;Symbol;Quantity;Price;Fee;Amount
+26.04.2019;Buy;VWRL;10;95,12;1,00;
+10.05.2019;Buy;vwrl;5;97,00;1,00;
+24.06.2019;Sell;VWRL;12;100,00;1,00;
+28.06.2019;Dividend;VWRL;;;;4,20
+`
+
+func brokerageConfig(booking string) Config {
+	config := DefaultConfigExample1
+	config.Csv.Skip = 0
+	config.Csv.SkipUntil = "^Date;"
+	config.Csv.AmountIn = Column{Index: -1, Name: "Amount"}
+	config.Csv.AmountOut = config.Csv.AmountIn
+	config.Csv.Date = Column{Index: -1, Name: "Date"}
+	config.Csv.Description = Column{Index: -1, Name: "Type"}
+	config.Csv.Payee = Column{Index: -1, Name: "Symbol"}
+	config.Csv.ProcessingAccount = "Assets:Broker:Cash"
+	config.Csv.Fees = []Fee{{Account: "Expenses:Broker:Fees", Column: Column{Index: -1, Name: "Fee"}}}
+	config.Csv.Brokerage = &BrokerageConfig{
+		Action:          &Column{Index: -1, Name: "Type"},
+		Booking:         booking,
+		Buy:             []string{"buy"},
+		GainsAccount:    "Income:Capital-Gains",
+		HoldingsAccount: "Assets:Broker:{symbol}",
+		Price:           Column{Index: -1, Name: "Price"},
+		Quantity:        Column{Index: -1, Name: "Quantity"},
+		Sell:            []string{"sell"},
+		Symbol:          Column{Index: -1, Name: "Symbol"},
+	}
+	config.TransactionsRules = TransactionsRulesConfig{}
+
+	return config
+}
+
+func TestProcessCsvFileBrokerage(t *testing.T) {
+	var tests = []struct {
+		name    string
+		booking string
+		want    string
+	}{
+		{
+			"test #1 empty cost specification",
+			BookingEmpty,
+			`2019-04-26
+  Assets:Broker:VWRL  10 VWRL {95.12 EUR}
+  Expenses:Broker:Fees  1.00 EUR
+  Assets:Broker:Cash  -952.20 EUR
+2019-05-10
+  Assets:Broker:VWRL  5 VWRL {97.00 EUR}
+  Expenses:Broker:Fees  1.00 EUR
+  Assets:Broker:Cash  -486.00 EUR
+2019-06-24
+  Assets:Broker:VWRL  -12 VWRL {} @ 100.00 EUR
+  Expenses:Broker:Fees  1.00 EUR
+  Assets:Broker:Cash  1199.00 EUR
+  Income:Capital-Gains
+2019-06-28
+  Expenses:Unknown  -4.20 EUR
+  Assets:Broker:Cash  4.20 EUR
+`,
+		},
+		{
+			"test #2 first in first out",
+			BookingFIFO,
+			`2019-04-26
+  Assets:Broker:VWRL  10 VWRL {95.12 EUR}
+  Expenses:Broker:Fees  1.00 EUR
+  Assets:Broker:Cash  -952.20 EUR
+2019-05-10
+  Assets:Broker:VWRL  5 VWRL {97.00 EUR}
+  Expenses:Broker:Fees  1.00 EUR
+  Assets:Broker:Cash  -486.00 EUR
+2019-06-24
+  Assets:Broker:VWRL  -10 VWRL {95.12 EUR, 2019-04-26} @ 100.00 EUR
+  Assets:Broker:VWRL  -2 VWRL {97.00 EUR, 2019-05-10} @ 100.00 EUR
+  Expenses:Broker:Fees  1.00 EUR
+  Assets:Broker:Cash  1199.00 EUR
+  Income:Capital-Gains  -54.80 EUR
+2019-06-28
+  Expenses:Unknown  -4.20 EUR
+  Assets:Broker:Cash  4.20 EUR
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			processCsvFile(strings.NewReader(brokerageCsvFile), brokerageConfig(tt.booking), "{{.Date}}{{range .Postings}}\n  {{.}}{{end}}\n", buf)
+
+			if buf.String() != tt.want {
+				t.Errorf("got %v, want %v", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessCsvFileBrokerageValue(t *testing.T) {
+	config := brokerageConfig(BookingFIFO)
+	config.Csv.Brokerage.Value = &Column{Index: -1, Name: "Value"}
+
+	// the cash leg of the buy is the value, not the rounded price times 3
+	file := `Date;Type;Symbol;Quantity;Price;Fee;Value;Amount
+26.04.2019;Buy;VWRL;3;33,3333;1,00;100,00;
+24.06.2019;Sell;VWRL;3;40,00;1,00;;
+`
+
+	want := `2019-04-26
+  Assets:Broker:VWRL  3 VWRL {33.3333 EUR}
+  Expenses:Broker:Fees  1.00 EUR
+  Assets:Broker:Cash  -101.00 EUR
+2019-06-24
+  Assets:Broker:VWRL  -3 VWRL {33.3333 EUR, 2019-04-26} @ 40.00 EUR
+  Expenses:Broker:Fees  1.00 EUR
+  Assets:Broker:Cash  119.00 EUR
+  Income:Capital-Gains  -20.0001 EUR
+`
+
+	buf := new(bytes.Buffer)
+	processCsvFile(strings.NewReader(file), config, "{{.Date}}{{range .Postings}}\n  {{.}}{{end}}\n", buf)
+
+	if buf.String() != want {
+		t.Errorf("got %v, want %v", buf.String(), want)
+	}
+}
+
+func TestBookLotsNotEnoughUnits(t *testing.T) {
+	config := brokerageConfig(BookingFIFO)
+	file := `Date;Type;Symbol;Quantity;Price;Fee;Amount
+24.06.2019;Sell;VWRL;12;100,00;;
+`
+
+	buf := new(bytes.Buffer)
+	processCsvFile(strings.NewReader(file), config, "{{range .Postings}}{{.}}\n{{end}}", buf)
+
+	want := `Assets:Broker:VWRL  -12 VWRL {} @ 100.00 EUR
+Assets:Broker:Cash  1200.00 EUR
+Income:Capital-Gains
+`
+
+	if buf.String() != want {
+		t.Errorf("got %v, want %v", buf.String(), want)
+	}
+}
@@ -0,0 +1,411 @@
+package internal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The codes of the balances of camt statements
+const (
+	CamtClosingBooked          = "CLBD" // The closing balance at the end of the day
+	CamtOpeningBooked          = "OPBD" // The opening balance at the start of the day
+	CamtPreviouslyClosedBooked = "PRCD" // The closing balance of the previous statement
+)
+
+// camtHeader names the fields of the rows of camt statements
+var camtHeader = []string{"BookingDate", "ValueDate", "Amount", "Currency", "CreditDebit", "Reference", "EndToEndId", "Name", "IBAN", "Remittance", "AdditionalInfo"}
+
+// camtColumns are the fields of camt statements the records are taken from
+var camtColumns = statementColumns{
+	amount:      "Amount",
+	currency:    "Currency",
+	date:        "BookingDate",
+	description: "Remittance",
+	id:          "Reference",
+	meta:        "reference",
+	payee:       "Name",
+}
+
+// camtDocument is a camt.053 statement or a camt.052 report document, the
+// elements being matched regardless of the version's namespace
+type camtDocument struct {
+	Reports    []camtStatement `xml:"BkToCstmrAcctRpt>Rpt"`
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+// camtStatement is a statement, or a report, of an account
+type camtStatement struct {
+	Account  camtAccount   `xml:"Acct"`
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+	ID       string        `xml:"Id"`
+}
+
+// camtAccount is the account of a statement
+type camtAccount struct {
+	BIC      string `xml:"Svcr>FinInstnId>BIC"`
+	BICFI    string `xml:"Svcr>FinInstnId>BICFI"`
+	Currency string `xml:"Ccy"`
+	IBAN     string `xml:"Id>IBAN"`
+	Other    string `xml:"Id>Othr>Id"`
+}
+
+// camtAmount is an amount, always positive, along with its currency
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// camtDate is a date, or a date and time
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// camtBalance is a balance of a statement
+type camtBalance struct {
+	Amount      camtAmount `xml:"Amt"`
+	Code        string     `xml:"Tp>CdOrPrtry>Cd"`
+	CreditDebit string     `xml:"CdtDbtInd"`
+	Date        camtDate   `xml:"Dt"`
+}
+
+// camtEntry is an entry of a statement, holding the details of one or, for
+// batch bookings, several transactions
+type camtEntry struct {
+	AdditionalInfo string            `xml:"AddtlNtryInf"`
+	Amount         camtAmount        `xml:"Amt"`
+	BookingDate    camtDate          `xml:"BookgDt"`
+	CreditDebit    string            `xml:"CdtDbtInd"`
+	Reference      string            `xml:"AcctSvcrRef"`
+	Reversal       bool              `xml:"RvslInd"`
+	Status         camtStatus        `xml:"Sts"`
+	Transactions   []camtTransaction `xml:"NtryDtls>TxDtls"`
+	ValueDate      camtDate          `xml:"ValDt"`
+}
+
+// camtStatus is the status of an entry, a code of its own from version 8 on
+type camtStatus struct {
+	Code  string `xml:"Cd"`
+	Value string `xml:",chardata"`
+}
+
+// camtTransaction holds the details of a transaction of an entry
+type camtTransaction struct {
+	AdditionalInfo   string      `xml:"AddtlTxInf"`
+	Amount           *camtAmount `xml:"Amt"`
+	Creditor         camtParty   `xml:"RltdPties>Cdtr"`
+	CreditorAccount  string      `xml:"RltdPties>CdtrAcct>Id>IBAN"`
+	Debtor           camtParty   `xml:"RltdPties>Dbtr"`
+	DebtorAccount    string      `xml:"RltdPties>DbtrAcct>Id>IBAN"`
+	EndToEndID       string      `xml:"Refs>EndToEndId"`
+	Reference        string      `xml:"Refs>AcctSvcrRef"`
+	Structured       []string    `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	TransactionAmt   *camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	UltimateCreditor camtParty   `xml:"RltdPties>UltmtCdtr"`
+	UltimateDebtor   camtParty   `xml:"RltdPties>UltmtDbtr"`
+	Unstructured     []string    `xml:"RmtInf>Ustrd"`
+}
+
+// camtParty is a debtor or a creditor, its name nested in a party of its
+// own from version 8 on
+type camtParty struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+// ProcessCamtFile ...
+func ProcessCamtFile(file io.Reader, config Config, template string) {
+	processCamtFile(file, config, template, os.Stdout)
+}
+
+// processCamtFile converts every statement of a camt.053 file, or report of
+// a camt.052 file, the transactions of each being converted like the rows
+// of a csv file
+func processCamtFile(file io.Reader, config Config, template string, output io.Writer) {
+	statements, err := parseCamt(file)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("error reading camt file")
+	}
+
+	for _, s := range statements {
+		processStatement(s, config, template, output)
+	}
+}
+
+// parseCamt reads the statements of a camt.053 file or the reports of a
+// camt.052 file
+func parseCamt(file io.Reader) ([]statement, error) {
+	var document camtDocument
+
+	if err := xml.NewDecoder(file).Decode(&document); err != nil {
+		return nil, err
+	}
+
+	var statements []statement
+
+	for _, s := range append(document.Statements, document.Reports...) {
+		converted, err := camtStatementOf(s)
+		if err != nil {
+			return nil, fmt.Errorf("statement %q: %v", s.ID, err)
+		}
+
+		statements = append(statements, converted)
+	}
+
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("no camt.053 statement or camt.052 report found")
+	}
+
+	return statements, nil
+}
+
+// camtStatementOf lays out the booked entries of a camt statement as rows
+// of the camtHeader fields, and reads its opening and closing balances
+func camtStatementOf(s camtStatement) (statement, error) {
+	account := s.Account.IBAN
+	if account == "" {
+		account = s.Account.Other
+	}
+
+	bic := s.Account.BICFI
+	if bic == "" {
+		bic = s.Account.BIC
+	}
+
+	converted := statement{
+		columns:  camtColumns,
+		currency: s.Account.Currency,
+		header:   camtHeader,
+		info: map[string]string{
+			"account":  account,
+			"bic":      bic,
+			"currency": s.Account.Currency,
+			"id":       s.ID,
+		},
+	}
+
+	for _, entry := range s.Entries {
+		if status := entry.status(); status != "" && status != "BOOK" {
+			log.WithFields(log.Fields{
+				"reference": entry.Reference,
+				"status":    status,
+			}).Debug("skipping an entry that isn't booked")
+
+			continue
+		}
+
+		rows, err := entry.rows()
+		if err != nil {
+			return converted, fmt.Errorf("entry %q: %v", entry.Reference, err)
+		}
+
+		converted.rows = append(converted.rows, rows...)
+	}
+
+	for _, balance := range s.Balances {
+		var closing bool
+
+		switch balance.Code {
+		case CamtOpeningBooked:
+		case CamtClosingBooked, CamtPreviouslyClosedBooked:
+			closing = true
+		default:
+			continue
+		}
+
+		amount, err := camtSigned(balance.Amount, balance.CreditDebit)
+		if err != nil {
+			return converted, fmt.Errorf("balance %s: %v", balance.Code, err)
+		}
+
+		t, err := balance.Date.day()
+		if err != nil {
+			return converted, fmt.Errorf("balance %s: %v", balance.Code, err)
+		}
+
+		converted.balances = append(converted.balances, statementBalance{
+			amount:   amount,
+			closing:  closing,
+			currency: balance.Amount.Currency,
+			time:     t,
+		})
+	}
+
+	return converted, nil
+}
+
+// status returns the status code of the entry
+func (e camtEntry) status() string {
+	if code := strings.TrimSpace(e.Status.Code); code != "" {
+		return code
+	}
+
+	return strings.TrimSpace(e.Status.Value)
+}
+
+// rows returns the rows of the entry, one for each of its transactions when
+// it's a batch booking with the amounts of each, otherwise a single one
+func (e camtEntry) rows() ([][]string, error) {
+	transactions := e.Transactions
+
+	batch := len(transactions) > 1
+	for _, transaction := range transactions {
+		if transaction.amount() == nil {
+			batch = false
+		}
+	}
+
+	if !batch {
+		var transaction camtTransaction
+		if len(transactions) > 0 {
+			transaction = transactions[0]
+		}
+
+		row, err := e.row(transaction, e.Amount, e.Reference)
+		if err != nil {
+			return nil, err
+		}
+
+		return [][]string{row}, nil
+	}
+
+	var rows [][]string
+
+	for i, transaction := range transactions {
+		reference := transaction.Reference
+		if reference == "" && e.Reference != "" {
+			reference = fmt.Sprintf("%s-%d", e.Reference, i+1)
+		}
+
+		row, err := e.row(transaction, *transaction.amount(), reference)
+		if err != nil {
+			return nil, err
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// row lays out a transaction of the entry as a row of the camtHeader fields.
+// The counterparty is the debtor of credits and the creditor of debits, the
+// other way round for reversals, and the remittance information falls back
+// to the entry's additional information.
+func (e camtEntry) row(transaction camtTransaction, amount camtAmount, reference string) ([]string, error) {
+	signed, err := camtSigned(amount, e.CreditDebit)
+	if err != nil {
+		return nil, err
+	}
+
+	booking, err := e.BookingDate.day()
+	if err != nil {
+		return nil, fmt.Errorf("booking date: %v", err)
+	}
+
+	value := ""
+	if t, err := e.ValueDate.day(); err == nil {
+		value = t.Format(StatementDateLayout)
+	}
+
+	party, ultimate, iban := transaction.Debtor, transaction.UltimateDebtor, transaction.DebtorAccount
+	if (e.CreditDebit == "DBIT") != e.Reversal {
+		party, ultimate, iban = transaction.Creditor, transaction.UltimateCreditor, transaction.CreditorAccount
+	}
+
+	name := party.name()
+	if name == "" {
+		name = ultimate.name()
+	}
+
+	remittance := strings.Join(transaction.Unstructured, " ")
+	if remittance == "" {
+		remittance = strings.Join(transaction.Structured, " ")
+	}
+
+	additional := e.AdditionalInfo
+	if additional == "" {
+		additional = transaction.AdditionalInfo
+	}
+
+	if remittance == "" {
+		remittance = additional
+	}
+
+	return []string{
+		booking.Format(StatementDateLayout),
+		value,
+		signed.String(),
+		amount.Currency,
+		e.CreditDebit,
+		reference,
+		transaction.EndToEndID,
+		name,
+		iban,
+		remittance,
+		additional,
+	}, nil
+}
+
+// amount returns the amount of the transaction, nil if it has none
+func (t camtTransaction) amount() *camtAmount {
+	if t.Amount != nil {
+		return t.Amount
+	}
+
+	return t.TransactionAmt
+}
+
+// name returns the name of the party
+func (p camtParty) name() string {
+	if p.Name != "" {
+		return strings.TrimSpace(p.Name)
+	}
+
+	return strings.TrimSpace(p.PartyName)
+}
+
+// day returns the day of the date
+func (d camtDate) day() (time.Time, error) {
+	value := strings.TrimSpace(d.Date)
+	if value == "" {
+		value = strings.TrimSpace(d.DateTime)
+	}
+
+	if len(value) > 10 {
+		value = value[:10]
+	}
+
+	t, err := time.Parse(StatementDateLayout, value)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %q", value)
+	}
+
+	return t, nil
+}
+
+// camtSigned returns the amount, negative for debits
+func camtSigned(amount camtAmount, creditDebit string) (Decimal, error) {
+	value, err := ParseDecimal(amount.Value)
+	if err != nil {
+		return value, err
+	}
+
+	switch creditDebit {
+	case "CRDT":
+		return value.Abs(), nil
+	case "DBIT":
+		return value.Abs().Neg(), nil
+	default:
+		return value, fmt.Errorf("invalid credit/debit indicator %q", creditDebit)
+	}
+}
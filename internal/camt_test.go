@@ -0,0 +1,354 @@
+package internal
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var camt053File = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <GrpHdr>
+      <MsgId>053D2020-04-03T08:00:00.0</MsgId>
+      <CreDtTm>2020-04-03T08:00:00.0+02:00</CreDtTm>
+    </GrpHdr>
+    <Stmt>
+      <Id>0352C5320200403080000</Id>
+      <CreDtTm>2020-04-03T08:00:00.0+02:00</CreDtTm>
+      <Acct>
+        <Id>
+          <IBAN>DE91100000000123456789</IBAN>
+        </Id>
+        <Ccy>EUR</Ccy>
+        <Svcr>
+          <FinInstnId>
+            <BIC>MARKDEF1100</BIC>
+          </FinInstnId>
+        </Svcr>
+      </Acct>
+      <Bal>
+        <Tp>
+          <CdOrPrtry>
+            <Cd>PRCD</Cd>
+          </CdOrPrtry>
+        </Tp>
+        <Amt Ccy="EUR">1000.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Dt>
+          <Dt>2020-04-01</Dt>
+        </Dt>
+      </Bal>
+      <Bal>
+        <Tp>
+          <CdOrPrtry>
+            <Cd>CLBD</Cd>
+          </CdOrPrtry>
+        </Tp>
+        <Amt Ccy="EUR">3347.51</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Dt>
+          <Dt>2020-04-02</Dt>
+        </Dt>
+      </Bal>
+      <Ntry>
+        <Amt Ccy="EUR">52.49</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt>
+          <Dt>2020-04-02</Dt>
+        </BookgDt>
+        <ValDt>
+          <Dt>2020-04-01</Dt>
+        </ValDt>
+        <AcctSvcrRef>2020040212345</AcctSvcrRef>
+        <NtryDtls>
+          <TxDtls>
+            <Refs>
+              <EndToEndId>INV-2020-17</EndToEndId>
+            </Refs>
+            <RltdPties>
+              <Dbtr>
+                <Nm>Joe Money</Nm>
+              </Dbtr>
+              <Cdtr>
+                <Nm>Stadtwerke Musterstadt</Nm>
+              </Cdtr>
+              <CdtrAcct>
+                <Id>
+                  <IBAN>DE02120300000000202051</IBAN>
+                </Id>
+              </CdtrAcct>
+            </RltdPties>
+            <RmtInf>
+              <Ustrd>Abschlag Strom</Ustrd>
+              <Ustrd>April 2020</Ustrd>
+            </RmtInf>
+          </TxDtls>
+        </NtryDtls>
+        <AddtlNtryInf>LASTSCHRIFT</AddtlNtryInf>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">2400.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt>
+          <Dt>2020-04-02</Dt>
+        </BookgDt>
+        <ValDt>
+          <Dt>2020-04-02</Dt>
+        </ValDt>
+        <AcctSvcrRef>2020040212346</AcctSvcrRef>
+        <NtryDtls>
+          <TxDtls>
+            <RltdPties>
+              <Dbtr>
+                <Nm>Acme Corp GmbH</Nm>
+              </Dbtr>
+              <DbtrAcct>
+                <Id>
+                  <IBAN>DE89370400440532013000</IBAN>
+                </Id>
+              </DbtrAcct>
+            </RltdPties>
+            <RmtInf>
+              <Ustrd>LOHN / GEHALT 03/2020</Ustrd>
+            </RmtInf>
+          </TxDtls>
+        </NtryDtls>
+        <AddtlNtryInf>GUTSCHRIFT</AddtlNtryInf>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">99.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>PDNG</Sts>
+        <BookgDt>
+          <Dt>2020-04-03</Dt>
+        </BookgDt>
+        <AcctSvcrRef>2020040312347</AcctSvcrRef>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>
+`
+
+var camt052File = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.052.001.08">
+  <BkToCstmrAcctRpt>
+    <Rpt>
+      <Id>R1</Id>
+      <Acct>
+        <Id>
+          <Othr>
+            <Id>0123456789</Id>
+          </Othr>
+        </Id>
+        <Ccy>CHF</Ccy>
+      </Acct>
+      <Bal>
+        <Tp>
+          <CdOrPrtry>
+            <Cd>OPBD</Cd>
+          </CdOrPrtry>
+        </Tp>
+        <Amt Ccy="CHF">10.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Dt>
+          <DtTm>2020-05-04T00:00:00</DtTm>
+        </Dt>
+      </Bal>
+      <Ntry>
+        <Amt Ccy="CHF">300.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>
+          <Cd>BOOK</Cd>
+        </Sts>
+        <BookgDt>
+          <DtTm>2020-05-04T10:15:00</DtTm>
+        </BookgDt>
+        <AcctSvcrRef>B1</AcctSvcrRef>
+        <NtryDtls>
+          <TxDtls>
+            <Amt Ccy="CHF">100.00</Amt>
+            <RltdPties>
+              <Cdtr>
+                <Pty>
+                  <Nm>Hausverwaltung AG</Nm>
+                </Pty>
+              </Cdtr>
+            </RltdPties>
+            <RmtInf>
+              <Strd>
+                <CdtrRefInf>
+                  <Ref>210000000003139471430009017</Ref>
+                </CdtrRefInf>
+              </Strd>
+            </RmtInf>
+          </TxDtls>
+          <TxDtls>
+            <Refs>
+              <AcctSvcrRef>B1-X</AcctSvcrRef>
+            </Refs>
+            <AmtDtls>
+              <TxAmt>
+                <Amt Ccy="CHF">200.00</Amt>
+              </TxAmt>
+            </AmtDtls>
+            <RltdPties>
+              <Cdtr>
+                <Pty>
+                  <Nm>Versicherung AG</Nm>
+                </Pty>
+              </Cdtr>
+            </RltdPties>
+          </TxDtls>
+        </NtryDtls>
+        <AddtlNtryInf>Sammelauftrag</AddtlNtryInf>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="CHF">25.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <RvslInd>true</RvslInd>
+        <Sts>
+          <Cd>BOOK</Cd>
+        </Sts>
+        <BookgDt>
+          <Dt>2020-05-04</Dt>
+        </BookgDt>
+        <AcctSvcrRef>B2</AcctSvcrRef>
+        <NtryDtls>
+          <TxDtls>
+            <RltdPties>
+              <Dbtr>
+                <Pty>
+                  <Nm>Joe Money</Nm>
+                </Pty>
+              </Dbtr>
+              <Cdtr>
+                <Pty>
+                  <Nm>Fitnessstudio</Nm>
+                </Pty>
+              </Cdtr>
+            </RltdPties>
+          </TxDtls>
+        </NtryDtls>
+      </Ntry>
+    </Rpt>
+  </BkToCstmrAcctRpt>
+</Document>
+`
+
+func TestParseCamt(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		info     map[string]string
+		rows     [][]string
+		balances []statementBalance
+	}{
+		{
+			"camt.053",
+			camt053File,
+			map[string]string{"account": "DE91100000000123456789", "bic": "MARKDEF1100", "currency": "EUR", "id": "0352C5320200403080000"},
+			[][]string{
+				{"2020-04-02", "2020-04-01", "-52.49", "EUR", "DBIT", "2020040212345", "INV-2020-17", "Stadtwerke Musterstadt", "DE02120300000000202051", "Abschlag Strom April 2020", "LASTSCHRIFT"},
+				{"2020-04-02", "2020-04-02", "2400.00", "EUR", "CRDT", "2020040212346", "", "Acme Corp GmbH", "DE89370400440532013000", "LOHN / GEHALT 03/2020", "GUTSCHRIFT"},
+			},
+			[]statementBalance{
+				{amount: mustDecimal("1000.00"), closing: true, currency: "EUR", time: mustDate("2020-04-01")},
+				{amount: mustDecimal("3347.51"), closing: true, currency: "EUR", time: mustDate("2020-04-02")},
+			},
+		},
+		{
+			"camt.052",
+			camt052File,
+			map[string]string{"account": "0123456789", "bic": "", "currency": "CHF", "id": "R1"},
+			[][]string{
+				{"2020-05-04", "", "-100.00", "CHF", "DBIT", "B1-1", "", "Hausverwaltung AG", "", "210000000003139471430009017", "Sammelauftrag"},
+				{"2020-05-04", "", "-200.00", "CHF", "DBIT", "B1-X", "", "Versicherung AG", "", "Sammelauftrag", "Sammelauftrag"},
+				{"2020-05-04", "", "25.00", "CHF", "CRDT", "B2", "", "Fitnessstudio", "", "", ""},
+			},
+			[]statementBalance{
+				{amount: mustDecimal("-10.00"), currency: "CHF", time: mustDate("2020-05-04")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements, err := parseCamt(strings.NewReader(tt.file))
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			if len(statements) != 1 {
+				t.Fatalf("got %d statements, want 1", len(statements))
+			}
+
+			s := statements[0]
+
+			if !reflect.DeepEqual(s.info, tt.info) {
+				t.Errorf("got info %v, want %v", s.info, tt.info)
+			}
+
+			if !reflect.DeepEqual(s.rows, tt.rows) {
+				t.Errorf("got rows %q, want %q", s.rows, tt.rows)
+			}
+
+			if !reflect.DeepEqual(s.balances, tt.balances) {
+				t.Errorf("got balances %v, want %v", s.balances, tt.balances)
+			}
+		})
+	}
+}
+
+func TestParseCamtErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"not xml", "Date;Amount\n"},
+		{"no statement", "<Document><BkToCstmrDbtCdtNtfctn></BkToCstmrDbtCdtNtfctn></Document>"},
+		{"invalid amount", strings.Replace(camt053File, "52.49", "52,49", 1)},
+		{"invalid indicator", strings.Replace(camt053File, "<CdtDbtInd>DBIT", "<CdtDbtInd>D", 1)},
+		{"invalid date", strings.Replace(camt053File, "<Dt>2020-04-02</Dt>", "<Dt>02.04.2020</Dt>", 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseCamt(strings.NewReader(tt.file)); err == nil {
+				t.Errorf("got no error")
+			}
+		})
+	}
+}
+
+func TestProcessCamtFile(t *testing.T) {
+	config := DefaultConfigExample1
+	config.Csv.ProcessingAccount = "Assets:Girokonto"
+	config.TransactionsRules = TransactionsRulesConfig{
+		TransactionRule{Name: "salary", SetAccount: "Income:Salary", MatchDescription: "LOHN / GEHALT"},
+		TransactionRule{Name: "power", SetAccount: "Expenses:Utilities", Condition: Condition{Column: &Column{Index: -1, Name: "IBAN"}, Match: regexp.MustCompile("^DE02")}},
+	}
+
+	want := `2020-04-02 "Stadtwerke Musterstadt" "Abschlag Strom April 2020" map[reference:2020040212345]
+  Assets:Girokonto  -52.49 EUR
+  Expenses:Utilities  52.49 EUR
+2020-04-02 "Acme Corp GmbH" "LOHN / GEHALT 03/2020" map[reference:2020040212346]
+  Income:Salary  -2400.00 EUR
+  Assets:Girokonto  2400.00 EUR
+2020-04-02 balance Assets:Girokonto  1000.00 EUR
+
+2020-04-03 balance Assets:Girokonto  3347.51 EUR
+
+`
+
+	buf := new(bytes.Buffer)
+	processCamtFile(strings.NewReader(camt053File), config, "{{.Date}} {{printf \"%q\" .Payee}} {{printf \"%q\" .Narration}} {{.Meta}}{{range .Postings}}\n  {{.}}{{end}}\n", buf)
+
+	if buf.String() != want {
+		t.Errorf("got %v, want %v", buf.String(), want)
+	}
+}
@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Column identifies a csv field, either by its header text or by its zero
+// based index, the header text taking precedence once it's been resolved
+type Column struct {
+	Index int    // The field index, -1 when the column isn't configured
+	Name  string // The header text of the field, if configured by name
+}
+
+// getColumn reads a column from the config, which can be either an integer
+// index or the text of the column's header
+func getColumn(key string) Column {
+	return parseColumn(viper.GetString(key))
+}
+
+// parseColumn ...
+func parseColumn(value string) Column {
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		return Column{Index: -1}
+	}
+
+	if index, err := strconv.Atoi(value); err == nil {
+		return Column{Index: index}
+	}
+
+	return Column{Index: -1, Name: value}
+}
+
+// getOptionalColumn reads a column from the config, returning nil when it
+// isn't configured
+func getOptionalColumn(key string) *Column {
+	if strings.TrimSpace(viper.GetString(key)) == "" {
+		return nil
+	}
+
+	column := getColumn(key)
+
+	return &column
+}
+
+// value returns the field for this column, or an empty string if the
+// column isn't configured or the record doesn't have that many fields
+func (c *Column) value(record []string) string {
+	if c == nil || c.Index < 0 || c.Index >= len(record) {
+		return ""
+	}
+
+	return record[c.Index]
+}
+
+// resolve looks up the index of a named column in the header row, an exact
+// match is preferred over a case insensitive one
+func (c Column) resolve(header []string) (Column, error) {
+	if c.Name == "" {
+		return c, nil
+	}
+
+	for i, field := range header {
+		if strings.TrimSpace(field) == c.Name {
+			return Column{Index: i, Name: c.Name}, nil
+		}
+	}
+
+	for i, field := range header {
+		if strings.EqualFold(strings.TrimSpace(field), c.Name) {
+			return Column{Index: i, Name: c.Name}, nil
+		}
+	}
+
+	return c, fmt.Errorf("column %q not found in header %q", c.Name, header)
+}
+
+// columns returns pointers to every configured column of the config, so
+// they can be resolved against the header row in one go
+func (c *CsvConfig) columns() []*Column {
+	columns := []*Column{
+		&c.AmountIn,
+		&c.AmountOut,
+		&c.Date,
+		&c.Description,
+		&c.Payee,
+	}
+
+	// Optional columns are copied so resolving them doesn't alter the
+	// original config they're shared with.
+	for _, column := range []**Column{&c.Balance, &c.CurrencyColumn, &c.GroupBy, &c.Indicator, &c.OriginalAmount, &c.OriginalCurrency} {
+		if *column != nil {
+			copied := **column
+			*column = &copied
+			columns = append(columns, *column)
+		}
+	}
+
+	// As are the fee and posting columns, along with the slices holding them.
+	for _, fees := range []*[]Fee{&c.Fees, &c.Taxes} {
+		*fees = append([]Fee(nil), *fees...)
+		for i := range *fees {
+			columns = append(columns, &(*fees)[i].Column)
+		}
+	}
+
+	if c.Brokerage != nil {
+		brokerage := *c.Brokerage
+		c.Brokerage = &brokerage
+		columns = append(columns, &brokerage.Price, &brokerage.Quantity, &brokerage.Symbol)
+
+		for _, column := range []**Column{&brokerage.Action, &brokerage.Value} {
+			if *column != nil {
+				copied := **column
+				*column = &copied
+				columns = append(columns, *column)
+			}
+		}
+	}
+
+	if c.Exchange != nil {
+		exchange := *c.Exchange
+		c.Exchange = &exchange
+		columns = append(columns, &exchange.Price, &exchange.Quantity)
+
+		for _, column := range []**Column{&exchange.Base, &exchange.Fee, &exchange.FeeAsset, &exchange.FeeValue, &exchange.Pair, &exchange.Quote, &exchange.Side, &exchange.Value} {
+			if *column != nil {
+				copied := **column
+				*column = &copied
+				columns = append(columns, *column)
+			}
+		}
+	}
+
+	c.Postings = append([]PostingMap(nil), c.Postings...)
+	for i := range c.Postings {
+		if c.Postings[i].Column != nil {
+			copied := *c.Postings[i].Column
+			c.Postings[i].Column = &copied
+			columns = append(columns, c.Postings[i].Column)
+		}
+	}
+
+	return columns
+}
+
+// needsHeader reports whether any column is configured by its header text
+func (c CsvConfig) needsHeader() bool {
+	for _, column := range c.columns() {
+		if column.Name != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveColumns returns a copy of the config with all named columns
+// resolved to their index in the header row
+func (c CsvConfig) resolveColumns(header []string) (CsvConfig, error) {
+	for _, column := range c.columns() {
+		resolved, err := column.resolve(header)
+		if err != nil {
+			return c, err
+		}
+
+		*column = resolved
+	}
+
+	return c, nil
+}
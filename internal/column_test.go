@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestGetColumn(t *testing.T) {
+	var tests = []struct {
+		value string
+		want  Column
+	}{
+		{"", Column{Index: -1}},
+		{"7", Column{Index: 7}},
+		{" 2 ", Column{Index: 2}},
+		{"Auftraggeber/Empfänger", Column{Index: -1, Name: "Auftraggeber/Empfänger"}},
+	}
+
+	for _, tt := range tests {
+		testname := fmt.Sprintf("value: '%s'", tt.value)
+		t.Run(testname, func(t *testing.T) {
+			viper.Set("test.column", tt.value)
+			ans := getColumn("test.column")
+			if ans != tt.want {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveColumns(t *testing.T) {
+	header := []string{"Buchung", "Valuta", "Auftraggeber/Empfänger", "Buchungstext", "Verwendungszweck", "Saldo", "Währung", "Betrag", "Währung"}
+
+	var tests = []struct {
+		name   string
+		config CsvConfig
+		want   CsvConfig
+		err    bool
+	}{
+		{
+			"test #1 names and indexes",
+			CsvConfig{
+				AmountIn:    Column{Index: -1, Name: "Betrag"},
+				AmountOut:   Column{Index: -1, Name: "betrag"},
+				Date:        Column{Index: 0},
+				Description: Column{Index: -1, Name: "Verwendungszweck"},
+				Payee:       Column{Index: -1, Name: "Auftraggeber/Empfänger"},
+			},
+			CsvConfig{
+				AmountIn:    Column{Index: 7, Name: "Betrag"},
+				AmountOut:   Column{Index: 7, Name: "betrag"},
+				Date:        Column{Index: 0},
+				Description: Column{Index: 4, Name: "Verwendungszweck"},
+				Payee:       Column{Index: 2, Name: "Auftraggeber/Empfänger"},
+			},
+			false,
+		},
+		{
+			"test #2 unknown column",
+			CsvConfig{
+				Payee: Column{Index: -1, Name: "Empfänger"},
+			},
+			CsvConfig{},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ans, err := tt.config.resolveColumns(header)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+
+			if !tt.err && !reflect.DeepEqual(ans, tt.want) {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessCsvFileHeaderNames(t *testing.T) {
+	config := DefaultConfigExample1
+	config.Csv.Skip = 11
+	config.Csv.AmountIn = Column{Index: -1, Name: "Betrag"}
+	config.Csv.AmountOut = Column{Index: -1, Name: "Betrag"}
+	config.Csv.Date = Column{Index: -1, Name: "Buchung"}
+	config.Csv.Description = Column{Index: -1, Name: "Verwendungszweck"}
+	config.Csv.Payee = Column{Index: -1, Name: "Auftraggeber/Empf<E4>nger"}
+	config.TransactionsRules = TransactionsRulesConfig{}
+
+	buf := new(bytes.Buffer)
+	processCsvFile(strings.NewReader(INGDiBaCsvFile), config, RecordTemplate, buf)
+
+	want := `2019-04-26 * "Acme Corp GmbH" "LOHN / GEHALT 04/19"
+  Expenses:Unknown  -3784.22 EUR
+  Assets:Unknown  3784.22 EUR
+`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("got %v, want it to contain %v", buf.String(), want)
+	}
+}
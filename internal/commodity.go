@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"strings"
+)
+
+// digitNames spell out the leading digits of commodities, which beancount
+// commodities can't start with
+var digitNames = []string{"ZERO", "ONE", "TWO", "THREE", "FOUR", "FIVE", "SIX", "SEVEN", "EIGHT", "NINE"}
+
+// getCommodities reads the commodity map, with upper case keys since viper
+// lower cases them
+func getCommodities(commodities map[string]string) map[string]string {
+	if len(commodities) == 0 {
+		return nil
+	}
+
+	normalized := make(map[string]string, len(commodities))
+	for name, commodity := range commodities {
+		normalized[strings.ToUpper(name)] = commodity
+	}
+
+	return normalized
+}
+
+// normalizeCommodity turns an asset name into a valid beancount commodity,
+// using the configured map first, e.g. 1INCH to ONEINCH. Otherwise it's
+// upper cased, leading digits are spelled out, and characters beancount
+// doesn't allow are dropped.
+func normalizeCommodity(name string, config CsvConfig) string {
+	name = strings.ToUpper(strings.TrimSpace(name))
+
+	if commodity, ok := config.Commodities[name]; ok {
+		return commodity
+	}
+
+	var b strings.Builder
+
+	for i, r := range name {
+		switch {
+		case r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9':
+			if b.Len() == 0 {
+				b.WriteString(digitNames[r-'0'])
+				continue
+			}
+		case strings.ContainsRune("'._-", r) && b.Len() > 0 && i < len(name)-1:
+		default:
+			continue
+		}
+
+		b.WriteRune(r)
+	}
+
+	return strings.TrimRight(b.String(), "'._-")
+}
@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"testing"
+)
+
+func TestNormalizeCommodity(t *testing.T) {
+	config := CsvConfig{Commodities: getCommodities(map[string]string{"1inch": "ONEINCH", "iota": "MIOTA"})}
+
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{"BTC", "BTC"},
+		{" eth ", "ETH"},
+		{"1INCH", "ONEINCH"},
+		{"IOTA", "MIOTA"},
+		{"3CRV", "THREECRV"},
+		{"USDC.e", "USDC.E"},
+		{"BTC-", "BTC"},
+		{"€UR", "UR"},
+		{"VWRL", "VWRL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if ans := normalizeCommodity(tt.input, config); ans != tt.want {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+}
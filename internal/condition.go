@@ -0,0 +1,396 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+const (
+	// TypeDebit matches records taking money out of the processing account
+	TypeDebit = "debit"
+	// TypeCredit matches records putting money into the processing account
+	TypeCredit = "credit"
+)
+
+// ConditionDateLayout is the layout of the dates in conditions
+const ConditionDateLayout = "2006-01-02"
+
+// Condition is a node of a rule's condition tree, it holds when all of
+// the checks set on it hold
+type Condition struct {
+	All         []Condition    // Holds when all of these conditions hold
+	Any         []Condition    // Holds when any of these conditions hold
+	Not         *Condition     // Holds when this condition doesn't hold
+	Payee       *regexp.Regexp // A pattern the payee has to match
+	Description *regexp.Regexp // A pattern the description has to match
+	Column      *Column        // A raw csv column, checked against Match
+	Match       *regexp.Regexp // A pattern the column has to match
+	AmountGt    *Decimal       // The amount has to be greater than this
+	AmountLt    *Decimal       // The amount has to be less than this
+	Type        string         // Only match debit or credit records
+	DateFrom    time.Time      // The date has to be on or after this date, if set
+	DateTo      time.Time      // The date has to be on or before this date, if set
+	Weekdays    []time.Weekday // The date has to fall on one of these days
+}
+
+// getCondition reads a condition node, and its children, from the config,
+// stopping the conversion if it's invalid
+func getCondition(name string, node map[string]interface{}) Condition {
+	condition, err := parseCondition(node)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"rule":  name,
+			"error": err,
+		}).Fatal("error parsing rule condition")
+	}
+
+	return condition
+}
+
+// parseCondition reads a condition node, and its children, from the config
+func parseCondition(node map[string]interface{}) (condition Condition, err error) {
+	for _, value := range cast.ToSlice(node["all"]) {
+		child, err := parseCondition(getStringMap(value))
+		if err != nil {
+			return condition, err
+		}
+
+		condition.All = append(condition.All, child)
+	}
+
+	for _, value := range cast.ToSlice(node["any"]) {
+		child, err := parseCondition(getStringMap(value))
+		if err != nil {
+			return condition, err
+		}
+
+		condition.Any = append(condition.Any, child)
+	}
+
+	if value, ok := node["not"]; ok {
+		not, err := parseCondition(getStringMap(value))
+		if err != nil {
+			return condition, err
+		}
+
+		condition.Not = &not
+	}
+
+	if value, ok := node["column"]; ok {
+		column := parseColumn(cast.ToString(value))
+		condition.Column = &column
+	}
+
+	if value, ok := node["amount_gt"]; ok {
+		if condition.AmountGt, err = parseConditionAmount(value); err != nil {
+			return condition, err
+		}
+	}
+
+	if value, ok := node["amount_lt"]; ok {
+		if condition.AmountLt, err = parseConditionAmount(value); err != nil {
+			return condition, err
+		}
+	}
+
+	if condition.DateFrom, err = parseConditionDate(node["date_from"]); err != nil {
+		return condition, err
+	}
+
+	if condition.DateTo, err = parseConditionDate(node["date_to"]); err != nil {
+		return condition, err
+	}
+
+	if condition.Weekdays, err = parseConditionWeekdays(cast.ToStringSlice(node["weekdays"])); err != nil {
+		return condition, err
+	}
+
+	if condition.Payee, err = parseConditionPattern(node["payee"]); err != nil {
+		return condition, err
+	}
+
+	if condition.Description, err = parseConditionPattern(node["description"]); err != nil {
+		return condition, err
+	}
+
+	if condition.Match, err = parseConditionPattern(node["match"]); err != nil {
+		return condition, err
+	}
+
+	condition.Type = strings.ToLower(cast.ToString(node["type"]))
+
+	if condition.Column != nil && condition.Match == nil {
+		return condition, fmt.Errorf("column %q has no match pattern", cast.ToString(node["column"]))
+	}
+
+	return condition, nil
+}
+
+// needsHeader reports whether the condition, or any of its children, names
+// its column
+func (c Condition) needsHeader() bool {
+	if c.Column != nil && c.Column.Name != "" {
+		return true
+	}
+
+	for _, child := range append(append([]Condition{}, c.All...), c.Any...) {
+		if child.needsHeader() {
+			return true
+		}
+	}
+
+	return c.Not != nil && c.Not.needsHeader()
+}
+
+// resolveColumns returns a copy of the condition with its named columns,
+// and those of its children, resolved to their index in the header row
+func (c Condition) resolveColumns(header []string) (Condition, error) {
+	resolved := c
+
+	if c.Column != nil {
+		column, err := c.Column.resolve(header)
+		if err != nil {
+			return c, err
+		}
+
+		resolved.Column = &column
+	}
+
+	resolved.All = nil
+	for _, child := range c.All {
+		child, err := child.resolveColumns(header)
+		if err != nil {
+			return c, err
+		}
+
+		resolved.All = append(resolved.All, child)
+	}
+
+	resolved.Any = nil
+	for _, child := range c.Any {
+		child, err := child.resolveColumns(header)
+		if err != nil {
+			return c, err
+		}
+
+		resolved.Any = append(resolved.Any, child)
+	}
+
+	if c.Not != nil {
+		not, err := c.Not.resolveColumns(header)
+		if err != nil {
+			return c, err
+		}
+
+		resolved.Not = &not
+	}
+
+	return resolved, nil
+}
+
+// needsHeader reports whether any rule has a condition naming its column
+// or an expression referring to the columns by header text
+func (rules TransactionsRulesConfig) needsHeader() bool {
+	for _, rule := range rules {
+		if rule.Condition.needsHeader() || (rule.when != nil && rule.when.columns) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveColumns returns a copy of the rules with the named columns of
+// their conditions resolved to their index in the header row
+func (rules TransactionsRulesConfig) resolveColumns(header []string) (TransactionsRulesConfig, error) {
+	resolved := make(TransactionsRulesConfig, len(rules))
+
+	for i, rule := range rules {
+		condition, err := rule.Condition.resolveColumns(header)
+		if err != nil {
+			return rules, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+
+		rule.Condition = condition
+		resolved[i] = rule
+	}
+
+	return resolved, nil
+}
+
+// isEmpty reports whether the condition has no checks at all
+func (c Condition) isEmpty() bool {
+	return reflect.DeepEqual(c, Condition{})
+}
+
+// check evaluates the condition against a record, the first pattern to
+// match is kept in match for substitutions, unless it's already been set
+func (c Condition) check(record *Record, match *ruleMatch) bool {
+	for _, child := range c.All {
+		if !child.check(record, match) {
+			return false
+		}
+	}
+
+	if len(c.Any) > 0 {
+		matched := false
+		for _, child := range c.Any {
+			if child.check(record, match) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	if c.Not != nil {
+		// Patterns matched below a not are of no use for substitutions
+		if c.Not.check(record, &ruleMatch{}) {
+			return false
+		}
+	}
+
+	if c.Payee != nil && !checkCondition(c.Payee, record.Payee, match) {
+		return false
+	}
+
+	if c.Description != nil && !checkCondition(c.Description, record.Description, match) {
+		return false
+	}
+
+	if c.Column != nil && !checkCondition(c.Match, c.Column.value(record.fields), match) {
+		return false
+	}
+
+	return c.checkAmount(record) && c.checkDate(record)
+}
+
+// checkCondition matches a pattern, keeping the first match for substitutions
+func checkCondition(pattern *regexp.Regexp, str string, match *ruleMatch) bool {
+	m, ok := matchRule(pattern, str)
+	if ok && match.pattern == nil {
+		*match = m
+	}
+
+	return ok
+}
+
+// checkAmount ...
+func (c Condition) checkAmount(record *Record) bool {
+	if c.AmountGt == nil && c.AmountLt == nil && c.Type == "" {
+		return true
+	}
+
+	amount := record.amount
+
+	switch {
+	case c.AmountGt != nil && amount.Cmp(*c.AmountGt) <= 0:
+		return false
+	case c.AmountLt != nil && amount.Cmp(*c.AmountLt) >= 0:
+		return false
+	case c.Type == TypeDebit && amount.Sign() >= 0:
+		return false
+	case c.Type == TypeCredit && amount.Sign() < 0:
+		return false
+	}
+
+	return true
+}
+
+// checkDate ...
+func (c Condition) checkDate(record *Record) bool {
+	if !c.DateFrom.IsZero() && record.time.Before(c.DateFrom) {
+		return false
+	}
+
+	if !c.DateTo.IsZero() && record.time.After(c.DateTo) {
+		return false
+	}
+
+	if len(c.Weekdays) > 0 {
+		for _, day := range c.Weekdays {
+			if record.time.Weekday() == day {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// parseConditionDate parses a date bound of a condition, the zero time if
+// it isn't set
+func parseConditionDate(value interface{}) (time.Time, error) {
+	str := cast.ToString(value)
+	if str == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(ConditionDateLayout, str)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %q, expected the layout %s", str, ConditionDateLayout)
+	}
+
+	return t, nil
+}
+
+// parseConditionPattern compiles a pattern of a condition, nil if it isn't
+// set
+func parseConditionPattern(value interface{}) (*regexp.Regexp, error) {
+	str := cast.ToString(value)
+	if str == "" {
+		return nil, nil
+	}
+
+	pattern, err := regexp.Compile(str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", str, err)
+	}
+
+	return pattern, nil
+}
+
+// parseConditionWeekdays parses the days of a condition, each either the
+// name of the day or at least its first three letters, e.g. sat or Thurs
+func parseConditionWeekdays(values []string) ([]time.Weekday, error) {
+	var weekdays []time.Weekday
+
+	for _, value := range values {
+		day := strings.ToLower(strings.TrimSpace(value))
+		found := false
+
+		for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+			if len(day) >= 3 && strings.HasPrefix(strings.ToLower(weekday.String()), day) {
+				weekdays = append(weekdays, weekday)
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown day %q", value)
+		}
+	}
+
+	return weekdays, nil
+}
+
+// parseConditionAmount parses the amount bound of a condition
+func parseConditionAmount(value interface{}) (*Decimal, error) {
+	amount, err := ParseDecimal(cast.ToString(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q: %v", cast.ToString(value), err)
+	}
+
+	return &amount, nil
+}
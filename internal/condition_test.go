@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var ConditionRulesYamlConfig = `transactions_rules:
+  - name: amazon refund
+    payee: "AMAZON"
+    type: credit
+    set_account: "Expenses:Shopping:Refunds"
+  - name: amazon purchase
+    all:
+      - payee: "AMAZON"
+      - not:
+          description: "PRIME"
+    amount_lt: 0
+    set_account: "Expenses:Shopping"
+  - name: weekend lunch
+    any:
+      - column: "Buchungstext"
+        match: "^Kartenzahlung$"
+      - column: 4
+        match: "RESTAURANT"
+    weekdays: ["sat", "Sunday"]
+    amount_gt: -50
+    set_account: "Expenses:Food:EatingOut"
+  - name: legacy with condition
+    match_payee: "RYANAIR"
+    match_description: "DUBLIN"
+    date_from: "2019-04-01"
+    date_to: "2019-04-30"
+    set_account: "Expenses:Travel:Flights"
+`
+
+func TestCheckConditionRules(t *testing.T) {
+	viper.Reset()
+	SetViperDefaults("")
+
+	err := viper.ReadConfig(strings.NewReader(ConditionRulesYamlConfig))
+	if err != nil {
+		fmt.Println("Error reading config: ", err)
+	}
+
+	header := []string{"Buchung", "Valuta", "Auftraggeber/Empfänger", "Buchungstext", "Verwendungszweck"}
+
+	rules, err := getTransactionsRules(viper.Get("transactions_rules")).resolveColumns(header)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	config := Config{Csv: DefaultCsvConfig, TransactionsRules: rules}
+
+	var tests = []struct {
+		name   string
+		payee  string
+		text   string
+		desc   string
+		amount string
+		date   string
+		want   string
+	}{
+		{"test #1 amazon refund", "AMAZON EU", "Gutschrift", "ORDER 123", "23.99", "2019-04-23", "Expenses:Shopping:Refunds"},
+		{"test #2 amazon purchase", "AMAZON EU", "Lastschrift", "ORDER 123", "-23.99", "2019-04-23", "Expenses:Shopping"},
+		{"test #3 amazon prime is excluded", "AMAZON EU", "Lastschrift", "PRIME MEMBERSHIP", "-69.00", "2019-04-23", "Expenses:Unknown"},
+		{"test #4 weekend card payment", "CAFE", "Kartenzahlung", "", "-12.50", "2019-04-27", "Expenses:Food:EatingOut"},
+		{"test #5 weekend restaurant by column index", "BLOCK HOUSE", "Lastschrift", "RESTAURANT BERLIN", "-27.00", "2019-04-28", "Expenses:Food:EatingOut"},
+		{"test #6 weekday card payment", "CAFE", "Kartenzahlung", "", "-12.50", "2019-04-24", "Expenses:Unknown"},
+		{"test #7 weekend card payment above the limit", "CAFE", "Kartenzahlung", "", "-80.00", "2019-04-27", "Expenses:Unknown"},
+		{"test #8 legacy match within the date range", "VISA RYANAIR", "Lastschrift", "", "-16.00", "2019-04-24", "Expenses:Travel:Flights"},
+		{"test #9 legacy match outside the date range", "VISA RYANAIR", "Lastschrift", "", "-16.00", "2019-05-01", "Expenses:Unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, _ := time.Parse(ConditionDateLayout, tt.date)
+			record := Record{
+				Payee:       tt.payee,
+				Description: tt.desc,
+				Meta:        map[string]string{},
+				amount:      mustDecimal(tt.amount),
+				fields:      []string{tt.date, tt.date, tt.payee, tt.text, tt.desc},
+				header:      header,
+				time:        date,
+			}
+			account := "Expenses:Unknown"
+
+			checkRules(config, &record, &account)
+			if account != tt.want {
+				t.Errorf("got %v, want %v", account, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionSubstitutions(t *testing.T) {
+	condition := Condition{
+		All: []Condition{
+			{Not: &Condition{Payee: regexp.MustCompile("^(VISA)")}},
+			{Description: regexp.MustCompile(`LOHN / GEHALT (\d{2}/\d{2})`)},
+		},
+	}
+
+	record := Record{Payee: "Acme Corp GmbH", Description: "LOHN / GEHALT 04/19"}
+
+	var match ruleMatch
+	if !condition.check(&record, &match) {
+		t.Fatalf("expected the condition to hold")
+	}
+
+	if ans := match.expand("Salary ${1}"); ans != "Salary 04/19" {
+		t.Errorf("got %v, want %v", ans, "Salary 04/19")
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	var tests = []struct {
+		name string
+		node map[string]interface{}
+	}{
+		{"test #1 invalid date", map[string]interface{}{"date_from": "2019-13-01"}},
+		{"test #2 invalid nested date", map[string]interface{}{"any": []interface{}{map[string]interface{}{"date_to": "30.04.2019"}}}},
+		{"test #3 invalid amount", map[string]interface{}{"amount_gt": "-50,00"}},
+		{"test #4 unknown weekday", map[string]interface{}{"not": map[string]interface{}{"weekdays": []string{"Thr"}}}},
+		{"test #5 column without a match", map[string]interface{}{"column": "Buchungstext"}},
+		{"test #6 nested column without a match", map[string]interface{}{"all": []interface{}{map[string]interface{}{"column": 4, "payee": "AMAZON"}}}},
+		{"test #7 invalid pattern", map[string]interface{}{"payee": "AMAZON("}},
+		{"test #8 invalid nested pattern", map[string]interface{}{"not": map[string]interface{}{"column": "Buchungstext", "match": "[a-"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseCondition(tt.node); err == nil {
+				t.Errorf("got no error")
+			}
+		})
+	}
+}
+
+func TestParseConditionWeekdays(t *testing.T) {
+	var tests = []struct {
+		name   string
+		values []string
+		want   []time.Weekday
+		err    bool
+	}{
+		{"test #1 names and abbreviations", []string{"sat", "Sunday", "Thurs", "tue"}, []time.Weekday{time.Saturday, time.Sunday, time.Thursday, time.Tuesday}, false},
+		{"test #2 too short", []string{"th"}, nil, true},
+		{"test #3 unknown day", []string{"Mon", "Thr"}, nil, true},
+		{"test #4 none", nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ans, err := parseConditionWeekdays(tt.values)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want an error %v", err, tt.err)
+			}
+
+			if !reflect.DeepEqual(ans, tt.want) {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveConditionColumns(t *testing.T) {
+	header := []string{"Buchung", "Valuta", "Auftraggeber/Empfänger", "Buchungstext", "Verwendungszweck"}
+
+	rules := TransactionsRulesConfig{
+		TransactionRule{Name: "card", Condition: Condition{Any: []Condition{
+			{Column: &Column{Index: -1, Name: "buchungstext"}, Match: regexp.MustCompile("^Kartenzahlung$")},
+			{Not: &Condition{Column: &Column{Index: 4}, Match: regexp.MustCompile("PRIME")}},
+		}}},
+	}
+
+	if !rules.needsHeader() {
+		t.Errorf("expected the rules to need the header")
+	}
+
+	ans, err := rules.resolveColumns(header)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	if index := ans[0].Condition.Any[0].Column.Index; index != 3 {
+		t.Errorf("got index %v, want 3", index)
+	}
+
+	if index := rules[0].Condition.Any[0].Column.Index; index != -1 {
+		t.Errorf("resolving changed the configured rules, got index %v", index)
+	}
+
+	rules[0].Condition.Any[0].Column.Name = "Buchungstxt"
+	if _, err := rules.resolveColumns(header); err == nil {
+		t.Errorf("got no error for an unknown column")
+	}
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Decimal is an exact decimal number, an integer coefficient scaled by a
+// number of decimal places. The scale is kept through arithmetic, so an
+// amount parsed as 16.00 is formatted as 16.00 again, and sums have the
+// larger scale of their operands. The zero value is 0.
+type Decimal struct {
+	value *big.Int // The coefficient, nil is zero
+	scale int      // The number of decimal places
+}
+
+// NewDecimal returns value / 10^scale
+func NewDecimal(value int64, scale int) Decimal {
+	return Decimal{big.NewInt(value), scale}
+}
+
+// ParseDecimal parses a plain decimal number, e.g. -1234.56, the thousands
+// separators and locale specific formats are handled by parseAmount
+func ParseDecimal(s string) (Decimal, error) {
+	str := strings.TrimSpace(s)
+
+	negative := false
+	if strings.HasPrefix(str, "-") || strings.HasPrefix(str, "+") {
+		negative = str[0] == '-'
+		str = str[1:]
+	}
+
+	digits := str
+	scale := 0
+	if i := strings.Index(str, "."); i >= 0 {
+		digits = str[:i] + str[i+1:]
+		scale = len(str) - i - 1
+	}
+
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	value, _ := new(big.Int).SetString(digits, 10)
+	if negative {
+		value.Neg(value)
+	}
+
+	return Decimal{value, scale}, nil
+}
+
+// coefficient returns the coefficient, never nil
+func (d Decimal) coefficient() *big.Int {
+	if d.value == nil {
+		return new(big.Int)
+	}
+
+	return d.value
+}
+
+// rescale returns the coefficient for a scale at least as large as the
+// decimal's own scale
+func (d Decimal) rescale(scale int) *big.Int {
+	return new(big.Int).Mul(pow10(scale-d.scale), d.coefficient())
+}
+
+// Scale returns the number of decimal places
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of the decimal
+func (d Decimal) Sign() int {
+	return d.coefficient().Sign()
+}
+
+// IsZero reports whether the decimal is zero
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Neg returns -d
+func (d Decimal) Neg() Decimal {
+	return Decimal{new(big.Int).Neg(d.coefficient()), d.scale}
+}
+
+// Abs returns |d|
+func (d Decimal) Abs() Decimal {
+	return Decimal{new(big.Int).Abs(d.coefficient()), d.scale}
+}
+
+// Add returns d + o
+func (d Decimal) Add(o Decimal) Decimal {
+	scale := maxInt(d.scale, o.scale)
+
+	return Decimal{new(big.Int).Add(d.rescale(scale), o.rescale(scale)), scale}
+}
+
+// Sub returns d - o
+func (d Decimal) Sub(o Decimal) Decimal {
+	return d.Add(o.Neg())
+}
+
+// Mul returns d * o, with the sum of their scales
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{new(big.Int).Mul(d.coefficient(), o.coefficient()), d.scale + o.scale}
+}
+
+// Quo returns d / o rounded half away from zero to the given scale
+func (d Decimal) Quo(o Decimal, scale int) (Decimal, error) {
+	if o.IsZero() {
+		return Decimal{}, fmt.Errorf("division of %s by zero", d)
+	}
+
+	// d / o = (cd / 10^ds) / (co / 10^os), so scaled by 10^scale and with
+	// an extra digit to round it's cd * 10^(scale + 1 + os - ds) / co
+	num := new(big.Int).Set(d.coefficient())
+	den := new(big.Int).Set(o.coefficient())
+
+	if exp := scale + 1 + o.scale - d.scale; exp >= 0 {
+		num.Mul(num, pow10(exp))
+	} else {
+		den.Mul(den, pow10(-exp))
+	}
+
+	return roundLastDigit(num.Quo(num, den), scale), nil
+}
+
+// pow10 returns 10^n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// roundLastDigit drops the last digit of a coefficient, rounding half away
+// from zero, and returns it as a decimal of the given scale
+func roundLastDigit(value *big.Int, scale int) Decimal {
+	q, r := new(big.Int).QuoRem(value, big.NewInt(10), new(big.Int))
+
+	if r.CmpAbs(big.NewInt(5)) >= 0 {
+		q.Add(q, big.NewInt(int64(value.Sign())))
+	}
+
+	return Decimal{q, scale}
+}
+
+// Round returns d rounded half away from zero to the given scale, or padded
+// with zeros if it has fewer decimal places
+func (d Decimal) Round(scale int) Decimal {
+	if scale >= d.scale {
+		return Decimal{d.rescale(scale), scale}
+	}
+
+	return roundLastDigit(new(big.Int).Quo(d.coefficient(), pow10(d.scale-scale-1)), scale)
+}
+
+// trim drops the trailing zeros of the decimal places
+func (d Decimal) trim() Decimal {
+	for d.scale > 0 && d.value != nil && new(big.Int).Rem(d.value, big.NewInt(10)).Sign() == 0 {
+		d = Decimal{new(big.Int).Quo(d.value, big.NewInt(10)), d.scale - 1}
+	}
+
+	return d
+}
+
+// Cmp returns -1, 0 or +1 depending on whether d is less than, equal to or
+// greater than o
+func (d Decimal) Cmp(o Decimal) int {
+	scale := maxInt(d.scale, o.scale)
+
+	return d.rescale(scale).Cmp(o.rescale(scale))
+}
+
+// Float64 returns the nearest float64 value, for expressions
+func (d Decimal) Float64() float64 {
+	f, _ := new(big.Rat).SetFrac(d.coefficient(), pow10(d.scale)).Float64()
+
+	return f
+}
+
+// String formats the decimal with all of its decimal places, e.g. -16.00
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.coefficient()).String()
+
+	if d.scale > 0 {
+		if len(digits) <= d.scale {
+			digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+		}
+
+		digits = digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+	}
+
+	if d.Sign() < 0 {
+		return "-" + digits
+	}
+
+	return digits
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"testing"
+)
+
+// mustDecimal parses a decimal for the test tables
+func mustDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return d
+}
+
+// mustDecimalPtr parses a decimal for the test tables, as a pointer
+func mustDecimalPtr(s string) *Decimal {
+	d := mustDecimal(s)
+
+	return &d
+}
+
+func TestParseDecimal(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+		err   bool
+	}{
+		{"16.00", "16.00", false},
+		{"-16.00", "-16.00", false},
+		{"+0.5", "0.5", false},
+		{".5", "0.5", false},
+		{"-0.00", "0.00", false},
+		{"1234", "1234", false},
+		{" 42.10 ", "42.10", false},
+		{"--16.00", "", true},
+		{"1.234,56", "", true},
+		{"", "", true},
+		{"abc", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			ans, err := ParseDecimal(tt.input)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+
+			if err == nil && ans.String() != tt.want {
+				t.Errorf("got %s, want %s", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	var tests = []struct {
+		name string
+		ans  Decimal
+		want string
+	}{
+		{"add keeps the larger scale", mustDecimal("0.1").Add(mustDecimal("0.20")), "0.30"},
+		{"add is exact", mustDecimal("0.1").Add(mustDecimal("0.2")), "0.3"},
+		{"sub", mustDecimal("6823.05").Sub(mustDecimal("16.00")), "6807.05"},
+		{"sub to negative", mustDecimal("5").Sub(mustDecimal("16.00")), "-11.00"},
+		{"neg", mustDecimal("16.00").Neg(), "-16.00"},
+		{"abs", mustDecimal("-16.00").Abs(), "16.00"},
+		{"mul", mustDecimal("1250.01").Mul(mustDecimal("50")), "62500.50"},
+		{"zero value", Decimal{}, "0"},
+		{"zero value add", Decimal{}.Add(mustDecimal("1.50")), "1.50"},
+		{"new", NewDecimal(-1600, 2), "-16.00"},
+		{"new small", NewDecimal(5, 3), "0.005"},
+		{"trim", mustDecimal("15000.0500").trim(), "15000.05"},
+		{"trim integer", mustDecimal("15000.000").trim(), "15000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.ans.String() != tt.want {
+				t.Errorf("got %s, want %s", tt.ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimalRound(t *testing.T) {
+	var tests = []struct {
+		input string
+		scale int
+		want  string
+	}{
+		{"625.005", 2, "625.01"},
+		{"625.004", 2, "625.00"},
+		{"-0.025", 2, "-0.03"},
+		{"-0.024", 2, "-0.02"},
+		{"0.5", 0, "1"},
+		{"16", 2, "16.00"},
+		{"16.00", 2, "16.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			ans := mustDecimal(tt.input).Round(tt.scale)
+			if ans.String() != tt.want {
+				t.Errorf("got %s, want %s", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimalQuo(t *testing.T) {
+	var tests = []struct {
+		x, y  string
+		scale int
+		want  string
+	}{
+		{"100.00", "3", 2, "33.33"},
+		{"200.00", "3", 2, "66.67"},
+		{"-200.00", "3", 2, "-66.67"},
+		{"1", "8", 3, "0.125"},
+		{"1", "0.125", 0, "8"},
+		{"14.20", "16.00", 4, "0.8875"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.x+"/"+tt.y, func(t *testing.T) {
+			ans, err := mustDecimal(tt.x).Quo(mustDecimal(tt.y), tt.scale)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			if ans.String() != tt.want {
+				t.Errorf("got %s, want %s", ans, tt.want)
+			}
+		})
+	}
+
+	if _, err := mustDecimal("1").Quo(Decimal{}, 2); err == nil {
+		t.Errorf("got no error dividing by zero")
+	}
+}
+
+func TestDecimalCmp(t *testing.T) {
+	var tests = []struct {
+		x, y string
+		want int
+	}{
+		{"16.00", "16", 0},
+		{"-16.00", "0", -1},
+		{"0.10", "0.09", 1},
+		{"-50", "-50.01", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.x+" "+tt.y, func(t *testing.T) {
+			if ans := mustDecimal(tt.x).Cmp(mustDecimal(tt.y)); ans != tt.want {
+				t.Errorf("got %d, want %d", ans, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ExchangeConfig is the config for converting crypto exchange csv files,
+// which have a trade of a base asset against a quote asset on each row
+type ExchangeConfig struct {
+	Account      string   // The account of each asset, {asset} is replaced by the commodity
+	Base         *Column  // The base asset field, when the pair isn't in a single field
+	Buy          []string // The side values of buys of the base asset
+	Fee          *Column  // The fee field, optional
+	FeeAccount   string   // The account of the fees
+	FeeAsset     *Column  // The asset the fee is charged in, the quote asset if not set
+	FeeValue     *Column  // The value of the fee in the currency, for fees in a crypto asset that isn't traded
+	Fiat         []string // The commodities held without a cost, the currency if empty
+	GainsAccount string   // The account of the capital gains of disposed assets
+	Pair         *Column  // The pair field, e.g. BTC/EUR
+	Price        Column   // The price of a unit of the base asset, in the quote asset
+	Quantity     Column   // The number of units of the base asset field
+	Quote        *Column  // The quote asset field, when the pair isn't in a single field
+	Sell         []string // The side values of sells of the base asset
+	Side         *Column  // The buy/sell field, the sign of the quantity is used if not set
+	Value        *Column  // The value of the trade in the currency, for trades between crypto assets
+}
+
+// getExchange reads the exchange config, nil if it isn't configured
+func getExchange() *ExchangeConfig {
+	if !viper.IsSet("csv.exchange") {
+		return nil
+	}
+
+	exchange := &ExchangeConfig{
+		Account:      viper.GetString("csv.exchange.account"),
+		Base:         getOptionalColumn("csv.exchange.base"),
+		Buy:          viper.GetStringSlice("csv.exchange.buy"),
+		Fee:          getOptionalColumn("csv.exchange.fee"),
+		FeeAccount:   viper.GetString("csv.exchange.fee_account"),
+		FeeAsset:     getOptionalColumn("csv.exchange.fee_asset"),
+		FeeValue:     getOptionalColumn("csv.exchange.fee_value"),
+		Fiat:         viper.GetStringSlice("csv.exchange.fiat"),
+		GainsAccount: viper.GetString("csv.exchange.gains_account"),
+		Pair:         getOptionalColumn("csv.exchange.pair"),
+		Price:        getColumn("csv.exchange.price"),
+		Quantity:     getColumn("csv.exchange.quantity"),
+		Quote:        getOptionalColumn("csv.exchange.quote"),
+		Sell:         viper.GetStringSlice("csv.exchange.sell"),
+		Side:         getOptionalColumn("csv.exchange.side"),
+		Value:        getOptionalColumn("csv.exchange.value"),
+	}
+
+	if exchange.Account == "" {
+		exchange.Account = "Assets:Exchange:{asset}"
+	}
+
+	if len(exchange.Buy) == 0 {
+		exchange.Buy = []string{"buy"}
+	}
+
+	if exchange.FeeAccount == "" {
+		exchange.FeeAccount = "Expenses:Exchange:Fees"
+	}
+
+	if exchange.GainsAccount == "" {
+		exchange.GainsAccount = "Income:Capital-Gains"
+	}
+
+	if len(exchange.Sell) == 0 {
+		exchange.Sell = []string{"sell"}
+	}
+
+	if exchange.Pair == nil && (exchange.Base == nil || exchange.Quote == nil) {
+		log.Fatal("exchange needs either a pair or a base and a quote column")
+	}
+
+	return exchange
+}
+
+// exchangeTrade is a trade of a base asset against a quote asset
+type exchangeTrade struct {
+	base     string  // The base asset
+	fee      Decimal // The fee, zero if there's none
+	feeAsset string  // The asset the fee is charged in
+	feeValue Decimal // The value of the fee in the currency, zero if it isn't given
+	price    Decimal // The price of a unit of the base asset, in the quote asset
+	quantity Decimal // The units of the base asset, negative for sells
+	quote    string  // The quote asset
+	value    Decimal // The value of the trade in the currency, zero if it isn't given
+}
+
+// getExchangeTrade reads the trade of a record, nil if the record isn't a
+// buy or a sell so it can be converted from its amount like any other record
+func getExchangeTrade(record []string, config CsvConfig) (*exchangeTrade, error) {
+	exchange := config.Exchange
+
+	sign := 0
+
+	if exchange.Side != nil {
+		side := strings.TrimSpace(exchange.Side.value(record))
+
+		switch {
+		case containsFold(exchange.Buy, side):
+			sign = 1
+		case containsFold(exchange.Sell, side):
+			sign = -1
+		default:
+			return nil, nil
+		}
+	}
+
+	value := exchange.Quantity.value(record)
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	quantity, err := parseAmount(value, config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quantity: %v", err)
+	}
+
+	switch sign {
+	case 1:
+		quantity = quantity.Abs()
+	case -1:
+		quantity = quantity.Abs().Neg()
+	}
+
+	if quantity.IsZero() {
+		return nil, nil
+	}
+
+	price, err := parseAmount(exchange.Price.value(record), config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price: %v", err)
+	}
+
+	base, quote := exchange.Base.value(record), exchange.Quote.value(record)
+	if exchange.Pair != nil {
+		if base, quote, err = splitPair(exchange.Pair.value(record)); err != nil {
+			return nil, err
+		}
+	}
+
+	t := &exchangeTrade{
+		base:     normalizeCommodity(base, config),
+		price:    price.Abs(),
+		quantity: quantity,
+		quote:    normalizeCommodity(quote, config),
+	}
+
+	if t.base == "" || t.quote == "" {
+		return nil, fmt.Errorf("missing base or quote asset")
+	}
+
+	t.feeAsset = t.quote
+	if asset := exchange.FeeAsset.value(record); strings.TrimSpace(asset) != "" {
+		t.feeAsset = normalizeCommodity(asset, config)
+	}
+
+	if value := exchange.Fee.value(record); strings.TrimSpace(value) != "" {
+		fee, err := parseAmount(value, config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fee: %v", err)
+		}
+
+		t.fee = fee.Abs()
+	}
+
+	fiat := exchangeFiat(config)
+
+	if !containsFold(fiat, t.base) && !containsFold(fiat, t.quote) {
+		value := exchange.Value.value(record)
+		if strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("missing value in %s of a trade between %s and %s", config.Currency, t.base, t.quote)
+		}
+
+		if t.value, err = parseAmount(value, config); err != nil {
+			return nil, fmt.Errorf("invalid value: %v", err)
+		}
+
+		t.value = t.value.Abs()
+	}
+
+	if !t.fee.IsZero() && t.feeAsset != t.base && t.feeAsset != t.quote && !containsFold(fiat, t.feeAsset) {
+		value := exchange.FeeValue.value(record)
+		if strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("missing value in %s of the fee in %s", config.Currency, t.feeAsset)
+		}
+
+		if t.feeValue, err = parseAmount(value, config); err != nil {
+			return nil, fmt.Errorf("invalid fee value: %v", err)
+		}
+
+		t.feeValue = t.feeValue.Abs()
+	}
+
+	return t, nil
+}
+
+// exchangeFiat returns the commodities never held at cost, the currency if
+// none are configured
+func exchangeFiat(config CsvConfig) []string {
+	if len(config.Exchange.Fiat) == 0 {
+		return []string{config.Currency}
+	}
+
+	return config.Exchange.Fiat
+}
+
+// splitPair splits a pair such as BTC/EUR, BTC-EUR or BTC_EUR into its base
+// and quote assets
+func splitPair(pair string) (string, string, error) {
+	for _, separator := range []string{"/", "-", "_", ":"} {
+		if parts := strings.Split(pair, separator); len(parts) == 2 {
+			return parts[0], parts[1], nil
+		}
+	}
+
+	return "", "", fmt.Errorf("can't split pair %q into its base and quote assets", pair)
+}
+
+// postings returns the postings of the trade. Every leg is valued in one
+// currency, the fiat asset of the trade or, for trades between crypto
+// assets, the currency their value is given in: the acquired asset is held
+// at its cost in it, and the disposed asset is reduced with an empty cost
+// specification and priced in it, unless it's fiat, which is never held at
+// cost. The fee is booked in the asset it's charged in, at the cost of the
+// acquired asset or priced in the same currency, and disposing of any asset
+// held at cost leaves the capital gains for beancount to interpolate.
+func (t exchangeTrade) postings(config CsvConfig) []Posting {
+	exchange := config.Exchange
+	fiat := exchangeFiat(config)
+
+	account := func(asset string) string {
+		return strings.ReplaceAll(exchange.Account, "{asset}", asset)
+	}
+
+	total := t.total()
+
+	// the currency the trade is valued in, and the price of a unit of the
+	// base and of the quote asset in it
+	currency, basePrice, quotePrice := t.quote, t.price, NewDecimal(1, 0)
+	switch {
+	case containsFold(fiat, t.quote):
+	case containsFold(fiat, t.base):
+		currency, basePrice, quotePrice = t.base, NewDecimal(1, 0), unitPrice(NewDecimal(1, 0), t.price)
+	default:
+		currency, basePrice, quotePrice = config.Currency, unitPrice(t.value, t.quantity.Abs()), unitPrice(t.value, total)
+	}
+
+	prices := map[string]Decimal{t.base: basePrice, t.quote: quotePrice}
+	if !t.fee.IsZero() && !t.feeValue.IsZero() {
+		prices[t.feeAsset] = unitPrice(t.feeValue, t.fee)
+	}
+
+	// the acquired and disposed assets and their units
+	acquired, acquiredUnits := t.base, t.quantity.Abs()
+	disposed, disposedUnits := t.quote, total
+	if t.quantity.Sign() < 0 {
+		acquired, acquiredUnits = t.quote, total
+		disposed, disposedUnits = t.base, t.quantity.Abs()
+	}
+
+	gains := false
+
+	// a fee in the acquired asset is taken from what's received
+	received := acquiredUnits
+	if t.feeAsset == acquired && !t.fee.IsZero() {
+		received = received.Sub(t.fee)
+	}
+
+	in := Posting{Account: account(acquired), Amount: &received, Commodity: acquired}
+	if !containsFold(fiat, acquired) {
+		cost := prices[acquired]
+		in.Cost = &Cost{Amount: &cost, Commodity: currency}
+	}
+
+	paid := disposedUnits.Neg()
+	out := Posting{Account: account(disposed), Amount: &paid, Commodity: disposed}
+	if !containsFold(fiat, disposed) {
+		out.Cost = &Cost{}
+		out.Price = &Price{Amount: prices[disposed], Commodity: currency}
+		gains = true
+	}
+
+	postings := []Posting{in, out}
+
+	if !t.fee.IsZero() {
+		fee := t.fee
+		expense := Posting{Account: exchange.FeeAccount, Amount: &fee, Commodity: t.feeAsset}
+
+		switch {
+		case t.feeAsset == acquired:
+			expense.Cost = in.Cost
+			postings = append(postings, expense)
+		default:
+			charged := t.fee.Neg()
+			funding := Posting{Account: account(t.feeAsset), Amount: &charged, Commodity: t.feeAsset}
+
+			if !containsFold(fiat, t.feeAsset) {
+				expense.Price = &Price{Amount: prices[t.feeAsset], Commodity: currency}
+				funding.Cost = &Cost{}
+				gains = true
+			}
+
+			postings = append(postings, expense, funding)
+		}
+	}
+
+	if gains {
+		postings = append(postings, Posting{Account: exchange.GainsAccount})
+	}
+
+	return postings
+}
+
+// amount returns the fiat paid or received, from the exchange account's
+// point of view, or zero for trades between crypto assets
+func (t exchangeTrade) amount(config CsvConfig) Decimal {
+	if !containsFold(exchangeFiat(config), t.quote) {
+		return Decimal{}
+	}
+
+	total := t.total()
+	if t.quantity.Sign() > 0 {
+		return total.Neg()
+	}
+
+	return total
+}
+
+// total returns the units of the quote asset traded, exactly but without
+// more decimal places than needed beyond those of the price
+func (t exchangeTrade) total() Decimal {
+	total := t.quantity.Abs().Mul(t.price).trim()
+
+	return total.Round(maxInt(total.Scale(), t.price.Scale()))
+}
+
+// unitPrice returns the price of a unit, value / units, rounded to eight
+// decimal places and without trailing zeros
+func unitPrice(value, units Decimal) Decimal {
+	price, err := value.Quo(units, 8)
+	if err != nil {
+		return Decimal{}
+	}
+
+	return price.trim()
+}
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitPair(t *testing.T) {
+	var tests = []struct {
+		input string
+		base  string
+		quote string
+		err   bool
+	}{
+		{"BTC/EUR", "BTC", "EUR", false},
+		{"ETH-BTC", "ETH", "BTC", false},
+		{"1INCH_USDT", "1INCH", "USDT", false},
+		{"BTCEUR", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			base, quote, err := splitPair(tt.input)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+
+			if base != tt.base || quote != tt.quote {
+				t.Errorf("got %v %v, want %v %v", base, quote, tt.base, tt.quote)
+			}
+		})
+	}
+}
+
+func TestProcessCsvFileExchange(t *testing.T) {
+	file := `Date,Pair,Side,Amount,Price,Fee,Fee Coin,Value,Fee Value
+01.05.2021,BTC/EUR,BUY,0.5,30000.00,15.00,EUR,15000.00,15.00
+02.05.2021,ETH/BTC,BUY,10,0.05,0.0075,BNB,15000.00,3.00
+03.05.2021,1INCH/EUR,BUY,100,4.00,0.1,1INCH,400.00,0.40
+04.05.2021,BTC/EUR,SELL,0.25,40000.00,10.00,EUR,10000.00,10.00
+05.05.2021,ETH/BTC,SELL,2,0.05,0.0001,BTC,3200.00,3.20
+`
+
+	config := DefaultConfigExample1
+	config.Csv.Separator = ','
+	config.Csv.Skip = 1
+	config.Csv.Commodities = map[string]string{"1INCH": "ONEINCH"}
+	config.Csv.Exchange = &ExchangeConfig{
+		Account:      "Assets:Exchange:{asset}",
+		Buy:          []string{"buy"},
+		Fee:          &Column{Index: 5},
+		FeeAccount:   "Expenses:Exchange:Fees",
+		FeeAsset:     &Column{Index: 6},
+		FeeValue:     &Column{Index: -1, Name: "Fee Value"},
+		GainsAccount: "Income:Capital-Gains",
+		Pair:         &Column{Index: 1},
+		Price:        Column{Index: 4},
+		Quantity:     Column{Index: 3},
+		Sell:         []string{"sell"},
+		Side:         &Column{Index: 2},
+		Value:        &Column{Index: -1, Name: "Value"},
+	}
+	config.TransactionsRules = TransactionsRulesConfig{}
+
+	want := `2021-05-01
+  Assets:Exchange:BTC  0.5 BTC {30000.00 EUR}
+  Assets:Exchange:EUR  -15000.00 EUR
+  Expenses:Exchange:Fees  15.00 EUR
+  Assets:Exchange:EUR  -15.00 EUR
+2021-05-02
+  Assets:Exchange:ETH  10 ETH {1500 EUR}
+  Assets:Exchange:BTC  -0.50 BTC {} @ 30000 EUR
+  Expenses:Exchange:Fees  0.0075 BNB @ 400 EUR
+  Assets:Exchange:BNB  -0.0075 BNB {}
+  Income:Capital-Gains
+2021-05-03
+  Assets:Exchange:ONEINCH  99.9 ONEINCH {4.00 EUR}
+  Assets:Exchange:EUR  -400.00 EUR
+  Expenses:Exchange:Fees  0.1 ONEINCH {4.00 EUR}
+2021-05-04
+  Assets:Exchange:EUR  9990.00 EUR
+  Assets:Exchange:BTC  -0.25 BTC {} @ 40000.00 EUR
+  Expenses:Exchange:Fees  10.00 EUR
+  Income:Capital-Gains
+2021-05-05
+  Assets:Exchange:BTC  0.0999 BTC {32000 EUR}
+  Assets:Exchange:ETH  -2 ETH {} @ 1600 EUR
+  Expenses:Exchange:Fees  0.0001 BTC {32000 EUR}
+  Income:Capital-Gains
+`
+
+	buf := new(bytes.Buffer)
+	processCsvFile(strings.NewReader(file), config, "{{.Date}}{{range .Postings}}\n  {{.}}{{end}}\n", buf)
+
+	if buf.String() != want {
+		t.Errorf("got %v, want %v", buf.String(), want)
+	}
+}
+
+func TestGetExchangeTradeErrors(t *testing.T) {
+	config := CsvConfig{
+		Currency: "EUR",
+		Exchange: &ExchangeConfig{
+			Buy:      []string{"buy"},
+			Fee:      &Column{Index: 4},
+			FeeAsset: &Column{Index: 5},
+			FeeValue: &Column{Index: 7},
+			Pair:     &Column{Index: 0},
+			Price:    Column{Index: 3},
+			Quantity: Column{Index: 2},
+			Sell:     []string{"sell"},
+			Side:     &Column{Index: 1},
+			Value:    &Column{Index: 6},
+		},
+	}
+
+	var tests = []struct {
+		name   string
+		record []string
+	}{
+		{"missing value", []string{"ETH/BTC", "BUY", "10", "0.05", "", "", "", ""}},
+		{"missing fee value", []string{"BTC/EUR", "BUY", "0.5", "30000.00", "0.0075", "BNB", "", ""}},
+		{"invalid value", []string{"ETH/BTC", "BUY", "10", "0.05", "", "", "n/a", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := getExchangeTrade(tt.record, config); err == nil {
+				t.Errorf("got no error")
+			}
+		})
+	}
+}
+
+func TestExchangeTradeAmount(t *testing.T) {
+	config := CsvConfig{Currency: "EUR", Exchange: &ExchangeConfig{}}
+
+	var tests = []struct {
+		trade exchangeTrade
+		want  string
+	}{
+		{exchangeTrade{base: "BTC", quote: "EUR", quantity: mustDecimal("0.5"), price: mustDecimal("30000.00")}, "-15000.00"},
+		{exchangeTrade{base: "BTC", quote: "EUR", quantity: mustDecimal("-0.5"), price: mustDecimal("30000.00")}, "15000.00"},
+		{exchangeTrade{base: "ETH", quote: "BTC", quantity: mustDecimal("10"), price: mustDecimal("0.05")}, "0"},
+	}
+
+	for _, tt := range tests {
+		if ans := tt.trade.amount(config); !reflect.DeepEqual(ans.String(), tt.want) {
+			t.Errorf("got %v, want %v", ans, tt.want)
+		}
+	}
+}
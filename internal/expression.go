@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/ext"
+)
+
+// expression is a compiled rule expression in the CEL language, such as
+// `payee.startsWith("VISA") && amount < -100 && date.month == 12`
+type expression struct {
+	columns bool        // Whether the expression refers to the columns by header text
+	program cel.Program // The compiled program
+}
+
+// expressionDate is the date of a record in expressions
+type expressionDate struct {
+	Day     int    `cel:"day"`     // The day of the month
+	Month   int    `cel:"month"`   // The month, 1 for January
+	Weekday string `cel:"weekday"` // The weekday in lower case, e.g. saturday
+	Year    int    `cel:"year"`    // The year
+}
+
+// expressionStringMethods are the string methods added to the CEL ones
+var expressionStringMethods = map[string]func(string) string{
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"upper": strings.ToUpper,
+}
+
+// newExpressionEnvironment returns the CEL environment declaring the
+// variables and methods available to expressions
+func newExpressionEnvironment() (*cel.Env, error) {
+	options := []cel.EnvOption{
+		cel.CrossTypeNumericComparisons(true),
+		ext.NativeTypes(reflect.TypeOf(&expressionDate{}), ext.ParseStructTags(true)),
+		cel.Variable("amount", cel.DoubleType),
+		cel.Variable("columns", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("currency", cel.StringType),
+		cel.Variable("date", cel.ObjectType("internal.expressionDate")),
+		cel.Variable("description", cel.StringType),
+		cel.Variable("fields", cel.ListType(cel.StringType)),
+		cel.Variable("payee", cel.StringType),
+		cel.Variable("preamble", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("type", cel.StringType),
+	}
+
+	for name, method := range expressionStringMethods {
+		method := method
+
+		options = append(options, cel.Function(name, cel.MemberOverload(
+			"string_"+name,
+			[]*cel.Type{cel.StringType},
+			cel.StringType,
+			cel.UnaryBinding(func(value ref.Val) ref.Val {
+				return types.String(method(string(value.(types.String))))
+			}),
+		)))
+	}
+
+	return cel.NewEnv(options...)
+}
+
+// compileExpression parses and type checks an expression, which has to
+// result in a boolean, and compiles it into a program
+func compileExpression(source string) (*expression, error) {
+	env, err := newExpressionEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(source)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("expression results in %v, not a boolean", ast.OutputType())
+	}
+
+	program, err := env.Program(ast, cel.EvalOptions(cel.OptOptimize))
+	if err != nil {
+		return nil, err
+	}
+
+	columns := false
+	for _, reference := range ast.NativeRep().ReferenceMap() {
+		if reference.Name == "columns" {
+			columns = true
+		}
+	}
+
+	return &expression{columns: columns, program: program}, nil
+}
+
+// evalBool evaluates the expression with the variables of a record
+func (e *expression) evalBool(env map[string]interface{}) (bool, error) {
+	value, _, err := e.program.Eval(env)
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := value.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression results in %v, not a boolean", value)
+	}
+
+	return result, nil
+}
+
+// getExpressionEnvironment returns the variables of a record for expressions
+func getExpressionEnvironment(record *Record) map[string]interface{} {
+	columns := make(map[string]string)
+	for i, name := range record.header {
+		if _, ok := columns[name]; !ok && i < len(record.fields) {
+			columns[name] = record.fields[i]
+		}
+	}
+
+	preamble := record.Preamble
+	if preamble == nil {
+		preamble = map[string]string{}
+	}
+
+	fields := record.fields
+	if fields == nil {
+		fields = []string{}
+	}
+
+	env := map[string]interface{}{
+		"amount":      record.amount.Float64(),
+		"columns":     columns,
+		"currency":    record.Currency,
+		"description": record.Description,
+		"fields":      fields,
+		"payee":       record.Payee,
+		"preamble":    preamble,
+		"type":        TypeCredit,
+		"date": &expressionDate{
+			Day:     record.time.Day(),
+			Month:   int(record.time.Month()),
+			Weekday: strings.ToLower(record.time.Weekday().String()),
+			Year:    record.time.Year(),
+		},
+	}
+
+	if record.amount.Sign() < 0 {
+		env["type"] = TypeDebit
+	}
+
+	return env
+}
@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileExpression(t *testing.T) {
+	var tests = []struct {
+		source  string
+		columns bool
+		err     bool
+	}{
+		{`payee.startsWith("VISA") && amount < -100 && date.month == 12`, false, false},
+		{`columns["Buchungstext"] in ["Lastschrift", 'Gutschrift'] || fields[3] == "x"`, true, false},
+		{`!(description.lower().contains("prime"))`, false, false},
+		{`description.matches(r"\d+ DUBLIN")`, false, false},
+		{`"columns" in preamble`, false, false},
+		{`payer == "x"`, false, true},
+		{`payee.beginsWith("VISA")`, false, true},
+		{`payee.startsWith()`, false, true},
+		{`payee < 5`, false, true},
+		{`date.mnth == 12`, false, true},
+		{`description.matches("(KAUF")`, false, true},
+		{`description.matches("\d+")`, false, true},
+		{`amount < `, false, true},
+		{`(amount < 0`, false, true},
+		{`payee == "VISA`, false, true},
+		{`amount # 2`, false, true},
+		{`amount < 0 amount`, false, true},
+		{`payee`, false, true},
+	}
+
+	for _, tt := range tests {
+		testname := fmt.Sprintf("source: '%s'", tt.source)
+		t.Run(testname, func(t *testing.T) {
+			ans, err := compileExpression(tt.source)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want an error %v", err, tt.err)
+			}
+
+			if err == nil && ans.columns != tt.columns {
+				t.Errorf("got columns %v, want %v", ans.columns, tt.columns)
+			}
+		})
+	}
+}
+
+func TestEvalExpression(t *testing.T) {
+	date, _ := time.Parse(ConditionDateLayout, "2019-12-24")
+
+	record := &Record{
+		Currency:    "EUR",
+		Description: "NR8123456015 DUBLIN IE KAUFUMSATZ",
+		Payee:       "VISA RYANAIR",
+		Preamble:    map[string]string{"iban": "DE91 1000 0000 0123 4567 89"},
+		amount:      mustDecimal("-116.00"),
+		fields:      []string{"24.12.2019", "VISA RYANAIR", "Lastschrift"},
+		header:      []string{"Buchung", "Auftraggeber", "Buchungstext"},
+		time:        date,
+	}
+
+	var tests = []struct {
+		source string
+		want   bool
+		err    bool
+	}{
+		{`payee.startsWith("VISA") && amount < -100 && date.month == 12`, true, false},
+		{`payee.startsWith("VISA") && amount < -200`, false, false},
+		{`type == "debit" && date.weekday == "tuesday" && date.day == 24 && date.year == 2019`, true, false},
+		{`columns["Buchungstext"] in ["Lastschrift", "Gutschrift"]`, true, false},
+		{`columns.Buchungstext == "Lastschrift" && fields[1] == payee`, true, false},
+		{`description.matches("KAUF(UMSATZ)?$") && !description.contains("BERLIN")`, true, false},
+		{`preamble.iban.startsWith("DE91") && currency == "EUR"`, true, false},
+		{`-amount * 2.0 + 8.0 == 240.0 && amount == -116.0`, true, false},
+		{`payee.lower() == "visa ryanair" && payee.size() == 12 && fields.size() == 3`, true, false},
+		{`"iban" in preamble && !("bic" in preamble)`, true, false},
+		{`false || amount > 0 || true`, true, false},
+		{`description.matches(r"^NR\d+ DUBLIN") && date.weekday in ["saturday", "sunday"]`, false, false},
+		{`fields[7] == "x"`, false, true},
+		{`columns.Betrag == "x"`, false, true},
+	}
+
+	env := getExpressionEnvironment(record)
+
+	for _, tt := range tests {
+		testname := fmt.Sprintf("source: '%s'", tt.source)
+		t.Run(testname, func(t *testing.T) {
+			e, err := compileExpression(tt.source)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			ans, err := e.evalBool(env)
+			if ans != tt.want || (err != nil) != tt.err {
+				t.Errorf("got %v and %v, want %v and error %v", ans, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckRulesWhen(t *testing.T) {
+	when, err := compileExpression(`payee.startsWith("VISA") && amount < -100`)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	config := Config{
+		Csv: DefaultCsvConfig,
+		TransactionsRules: TransactionsRulesConfig{
+			TransactionRule{Name: "big card payments", SetAccount: "Expenses:Review", SetFlag: "!", when: when},
+		},
+	}
+
+	var tests = []struct {
+		amount string
+		want   string
+	}{
+		{"-116.00", "Expenses:Review"},
+		{"-16.00", "Expenses:Unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			record := Record{Payee: "VISA RYANAIR", Meta: map[string]string{}, amount: mustDecimal(tt.amount)}
+			account := "Expenses:Unknown"
+
+			checkRules(config, &record, &account)
+			if account != tt.want {
+				t.Errorf("got %v, want %v", account, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessCsvFileWhenColumns(t *testing.T) {
+	when, err := compileExpression(`columns["Buchungstext"] == "Kartenzahlung"`)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	// the columns are picked by index, so only the expression needs the header
+	config := Config{
+		Csv: CsvConfig{
+			AmountIn:          Column{Index: 3},
+			AmountOut:         Column{Index: 3},
+			Currency:          "EUR",
+			Date:              Column{Index: 0},
+			DateLayoutIn:      "02.01.2006",
+			DefaultAccount:    "Expenses:Unknown",
+			Description:       Column{Index: 2},
+			Payee:             Column{Index: 1},
+			ProcessingAccount: "Assets:Girokonto",
+			Separator:         ';',
+		},
+		TransactionsRules: TransactionsRulesConfig{
+			TransactionRule{Name: "card", SetAccount: "Expenses:Food", When: `columns["Buchungstext"] == "Kartenzahlung"`, when: when},
+		},
+	}
+
+	file := `Buchung;Auftraggeber;Buchungstext;Betrag
+24.04.2019;CAFE;Kartenzahlung;-12,50
+25.04.2019;LANDLORD;Dauerauftrag;-500,00
+`
+
+	want := `CAFE
+  Assets:Girokonto  -12.50 EUR
+  Expenses:Food  12.50 EUR
+LANDLORD
+  Assets:Girokonto  -500.00 EUR
+  Expenses:Unknown  500.00 EUR
+`
+
+	buf := new(bytes.Buffer)
+	processCsvFile(strings.NewReader(file), config, "{{.Payee}}{{range .Postings}}\n  {{.}}{{end}}\n", buf)
+
+	if buf.String() != want {
+		t.Errorf("got %v, want %v", buf.String(), want)
+	}
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// Fee is an extra amount column, such as a fee or a tax charged on top of
+// the amount, that is booked to its own account
+type Fee struct {
+	Account string // The account the fee is booked to
+	Column  Column // The fee field
+}
+
+// getFees reads the fee columns of a setting, which can be a single
+// column and account or a list of them
+func getFees(key string, value interface{}) (fees []Fee) {
+	if value == nil {
+		return nil
+	}
+
+	items, ok := value.([]interface{})
+	if !ok {
+		items = []interface{}{value}
+	}
+
+	for _, item := range items {
+		fee := getStringMap(item)
+
+		column := cast.ToString(fee["column"])
+		account := cast.ToString(fee["account"])
+
+		if column == "" || account == "" {
+			log.WithFields(log.Fields{
+				"setting": key,
+				"fee":     fee,
+			}).Fatal("fee columns need a column and an account")
+		}
+
+		fees = append(fees, Fee{Account: account, Column: parseColumn(column)})
+	}
+
+	return fees
+}
+
+// feePostings returns the postings of the fees charged on a record, which
+// are costs whichever sign they're written with, and their total
+func feePostings(record []string, config CsvConfig, commodity string) ([]Posting, Decimal) {
+	var postings []Posting
+	var total Decimal
+
+	for _, fee := range append(append([]Fee(nil), config.Fees...), config.Taxes...) {
+		value := fee.Column.value(record)
+		if value == "" {
+			continue
+		}
+
+		amount := parseRecordAmount(value, record, config).Abs()
+		if amount.IsZero() {
+			continue
+		}
+
+		total = total.Add(amount)
+		postings = append(postings, Posting{Account: fee.Account, Amount: &amount, Commodity: commodity})
+	}
+
+	return postings, total
+}
+
+// chargeFees books the fees against the processing account's posting, or
+// against a posting of their own when the processing account's posting is
+// converted from another currency and its price has to stay as it is
+func chargeFees(processing *Posting, fees []Posting, total Decimal) []Posting {
+	if len(fees) == 0 {
+		return nil
+	}
+
+	charged := total.Neg()
+
+	if processing.Price != nil {
+		return append([]Posting{{Account: processing.Account, Amount: &charged, Commodity: fees[0].Commodity}}, fees...)
+	}
+
+	amount := processing.Amount.Add(charged)
+	processing.Amount = &amount
+
+	return fees
+}
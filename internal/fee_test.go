@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetFees(t *testing.T) {
+	var tests = []struct {
+		name  string
+		value interface{}
+		want  []Fee
+	}{
+		{
+			"test #1 unset",
+			nil,
+			nil,
+		},
+		{
+			"test #2 single fee",
+			map[interface{}]interface{}{"column": "Fee", "account": "Expenses:Bank:Fees"},
+			[]Fee{{Account: "Expenses:Bank:Fees", Column: Column{Index: -1, Name: "Fee"}}},
+		},
+		{
+			"test #3 list of fees",
+			[]interface{}{
+				map[interface{}]interface{}{"column": 5, "account": "Expenses:Bank:Fees"},
+				map[interface{}]interface{}{"column": "FX Fee", "account": "Expenses:Bank:FX"},
+			},
+			[]Fee{
+				{Account: "Expenses:Bank:Fees", Column: Column{Index: 5}},
+				{Account: "Expenses:Bank:FX", Column: Column{Index: -1, Name: "FX Fee"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ans := getFees("csv.fees", tt.value); !reflect.DeepEqual(ans, tt.want) {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRecordFees(t *testing.T) {
+	config := DefaultConfigExample1
+	config.Csv.AmountIn = Column{Index: 2}
+	config.Csv.AmountOut = Column{Index: 2}
+	config.Csv.Description = Column{Index: 1}
+	config.Csv.Fees = []Fee{{Account: "Expenses:Bank:Fees", Column: Column{Index: 3}}}
+	config.Csv.Payee = Column{Index: 1}
+	config.Csv.Taxes = []Fee{{Account: "Expenses:Taxes", Column: Column{Index: 4}}}
+	config.TransactionsRules = nil
+
+	var tests = []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{
+			"test #1 payment received with a fee",
+			[]string{"24.04.2019", "Acme Corp GmbH", "100,00", "-3,20", ""},
+			[]string{"Expenses:Unknown  -100.00 EUR", "Assets:Unknown  96.80 EUR", "Expenses:Bank:Fees  3.20 EUR"},
+		},
+		{
+			"test #2 payment with a fee and a tax",
+			[]string{"24.04.2019", "Netflix", "-10,00", "0,50", "1,90"},
+			[]string{"Assets:Unknown  -12.40 EUR", "Expenses:Unknown  10.00 EUR", "Expenses:Bank:Fees  0.50 EUR", "Expenses:Taxes  1.90 EUR"},
+		},
+		{
+			"test #3 no fee",
+			[]string{"24.04.2019", "Netflix", "-10,00", "0,00", ""},
+			[]string{"Assets:Unknown  -10.00 EUR", "Expenses:Unknown  10.00 EUR"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ans []string
+			for _, posting := range formatRecord(tt.input, config).Postings {
+				ans = append(ans, posting.String())
+			}
+
+			if !reflect.DeepEqual(ans, tt.want) {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestChargeFeesConverted(t *testing.T) {
+	processing := Posting{Account: "Assets:Unknown", Amount: mustDecimalPtr("-16.00"), Commodity: "EUR", Price: &Price{Amount: mustDecimal("14.20"), Commodity: "GBP", Total: true}}
+	fees := []Posting{{Account: "Expenses:Bank:Fees", Amount: mustDecimalPtr("0.50"), Commodity: "EUR"}}
+
+	var ans []string
+	for _, posting := range chargeFees(&processing, fees, mustDecimal("0.50")) {
+		ans = append(ans, posting.String())
+	}
+
+	want := []string{"Assets:Unknown  -0.50 EUR", "Expenses:Bank:Fees  0.50 EUR"}
+	if !reflect.DeepEqual(ans, want) {
+		t.Errorf("got %v, want %v", ans, want)
+	}
+
+	if processing.Amount.String() != "-16.00" {
+		t.Errorf("got %v, want the converted posting unchanged", processing)
+	}
+}
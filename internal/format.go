@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The formats of the files to convert
+const (
+	FormatCamt  = "camt"  // ISO 20022 camt.053 statements and camt.052 reports
+	FormatCsv   = "csv"   // Comma, or otherwise, separated values
+	FormatMt940 = "mt940" // SWIFT mt940 statements and mt942 interim reports
+	FormatOds   = "ods"   // OpenDocument spreadsheets
+	FormatOfx   = "ofx"   // Open financial exchange, including qfx
+	FormatQif   = "qif"   // Quicken interchange format
+	FormatXlsx  = "xlsx"  // Excel workbooks
+)
+
+// formatExtensions are the formats implied by file extensions
+var formatExtensions = map[string]string{
+	".940":   FormatMt940,
+	".942":   FormatMt940,
+	".mt940": FormatMt940,
+	".mt942": FormatMt940,
+	".ods":   FormatOds,
+	".ofx":   FormatOfx,
+	".qfx":   FormatOfx,
+	".qif":   FormatQif,
+	".sta":   FormatMt940,
+	".xlsm":  FormatXlsx,
+	".xlsx":  FormatXlsx,
+	".xml":   FormatCamt,
+}
+
+// GetFormat returns the format of a file, either the given format or the one
+// its extension implies, csv if it implies none
+func GetFormat(file, format string) string {
+	if format != "" {
+		return strings.ToLower(format)
+	}
+
+	if format, ok := formatExtensions[strings.ToLower(filepath.Ext(file))]; ok {
+		return format
+	}
+
+	return FormatCsv
+}
+
+// ProcessFile converts a file of the given format
+func ProcessFile(file io.Reader, format string, config Config, template string) {
+	switch format {
+	case FormatCamt:
+		ProcessCamtFile(file, config, template)
+	case FormatCsv:
+		ProcessCsvFile(file, config, template)
+	case FormatMt940:
+		ProcessMt940File(file, config, template)
+	case FormatOds:
+		ProcessOdsFile(file, config, template)
+	case FormatOfx:
+		ProcessOfxFile(file, config, template)
+	case FormatQif:
+		ProcessQifFile(file, config, template)
+	case FormatXlsx:
+		ProcessXlsxFile(file, config, template)
+	default:
+		log.WithFields(log.Fields{
+			"format": format,
+		}).Fatal("unknown file format")
+	}
+}
@@ -0,0 +1,32 @@
+package internal
+
+import "testing"
+
+func TestGetFormat(t *testing.T) {
+	tests := []struct {
+		file   string
+		format string
+		want   string
+	}{
+		{"export.csv", "", FormatCsv},
+		{"export.txt", "", FormatCsv},
+		{"export.ofx", "", FormatOfx},
+		{"EXPORT.QFX", "", FormatOfx},
+		{"camt053.xml", "", FormatCamt},
+		{"umsaetze.STA", "", FormatMt940},
+		{"export.mt942", "", FormatMt940},
+		{"checking.qif", "", FormatQif},
+		{"Umsaetze.XLSX", "", FormatXlsx},
+		{"statement.ods", "", FormatOds},
+		{"export.txt", "OFX", FormatOfx},
+		{"export.ofx", "csv", FormatCsv},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file+" "+tt.format, func(t *testing.T) {
+			if ans := GetFormat(tt.file, tt.format); ans != tt.want {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+}
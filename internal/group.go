@@ -0,0 +1,114 @@
+package internal
+
+// groupRecords merges the records sharing a group, e.g. the rows of one
+// PayPal payment sharing its transaction id, into a single transaction at
+// the position of the group's first record. Records without a group are
+// kept as they are.
+func groupRecords(records []Record) []Record {
+	var grouped []Record
+
+	index := make(map[string]int)
+
+	for _, record := range records {
+		if record.group == "" {
+			grouped = append(grouped, record)
+			continue
+		}
+
+		i, ok := index[record.group]
+		if !ok {
+			index[record.group] = len(grouped)
+			grouped = append(grouped, record)
+
+			continue
+		}
+
+		grouped[i] = mergeRecords(grouped[i], record)
+	}
+
+	for i := range grouped {
+		if grouped[i].group != "" {
+			grouped[i].Postings = mergePostings(grouped[i].Postings)
+		}
+	}
+
+	return grouped
+}
+
+// mergeRecords adds a record to the first record of its group. The group
+// takes the first payee, narration, description and comment that isn't
+// empty, all of the tags, links, metadata and postings, and the latest
+// running balance.
+func mergeRecords(group, record Record) Record {
+	for _, field := range []struct{ group, record *string }{
+		{&group.Comment, &record.Comment},
+		{&group.Description, &record.Description},
+		{&group.Narration, &record.Narration},
+		{&group.Payee, &record.Payee},
+	} {
+		if *field.group == "" {
+			*field.group = *field.record
+		}
+	}
+
+	if record.Flag != FlagComplete {
+		group.Flag = record.Flag
+	}
+
+	applyRuleList(record.Tags, &group.Tags)
+	applyRuleList(record.Links, &group.Links)
+
+	meta := make(map[string]string)
+	applyRuleMeta(record.Meta, meta)
+	applyRuleMeta(group.Meta, meta)
+	group.Meta = meta
+
+	if record.balance != nil && !record.time.Before(group.time) {
+		group.Balance, group.balance = record.Balance, record.balance
+	}
+
+	group.Postings = append(append([]Posting(nil), group.Postings...), record.Postings...)
+
+	return group
+}
+
+// mergePostings sums up the postings of the same account and commodity,
+// leaving out those that cancel out. Postings at cost, with a price or
+// without an amount are kept as they are.
+func mergePostings(postings []Posting) []Posting {
+	var merged []Posting
+
+	index := make(map[[2]string]int)
+
+	for _, posting := range postings {
+		if posting.Cost != nil || posting.Price != nil || posting.Amount == nil {
+			merged = append(merged, posting)
+			continue
+		}
+
+		key := [2]string{posting.Account, posting.Commodity}
+
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, posting)
+
+			continue
+		}
+
+		sum := merged[i].Amount.Add(*posting.Amount)
+		merged[i].Amount = &sum
+	}
+
+	var kept []Posting
+
+	for _, posting := range merged {
+		if posting.Amount != nil && posting.Cost == nil && posting.Price == nil && posting.Amount.IsZero() {
+			continue
+		}
+
+		kept = append(kept, posting)
+	}
+
+	return kept
+}
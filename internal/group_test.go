@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProcessCsvFileGroupBy(t *testing.T) {
+	file := `Datum;Name;Typ;Währung;Brutto;Transaktionscode
+24.04.2019;Steam Games;Zahlung;USD;-10,00;1AB
+24.04.2019;;Währungsumrechnung;USD;10,00;1AB
+24.04.2019;;Währungsumrechnung;EUR;-9,10;1AB
+24.04.2019;;Bankgutschrift;EUR;9,10;1AB
+25.04.2019;Acme Corp GmbH;Zahlung;EUR;50,00;2CD
+`
+
+	config := DefaultConfigExample1
+	config.Csv.Skip = 1
+	config.Csv.AmountIn = Column{Index: 4}
+	config.Csv.AmountOut = Column{Index: 4}
+	config.Csv.CurrencyColumn = &Column{Index: 3}
+	config.Csv.Description = Column{Index: 2}
+	config.Csv.GroupBy = &Column{Index: 5}
+	config.Csv.Payee = Column{Index: 1}
+	config.Csv.ProcessingAccount = "Assets:PayPal"
+	config.TransactionsRules = TransactionsRulesConfig{
+		TransactionRule{Name: "steam", MatchPayee: "Steam", SetAccount: "Expenses:Games", AddTags: []string{"games"}},
+		TransactionRule{Name: "conversion", MatchDescription: "Währungsumrechnung", SetAccount: "Equity:Conversions"},
+		TransactionRule{Name: "funding", MatchDescription: "Bankgutschrift", SetAccount: "Assets:Bank"},
+	}
+
+	want := `2019-04-24 "Steam Games" "Zahlung" [games]
+  Expenses:Games  10.00 USD
+  Equity:Conversions  -10.00 USD
+  Equity:Conversions  9.10 EUR
+  Assets:Bank  -9.10 EUR
+2019-04-25 "Acme Corp GmbH" "Zahlung" []
+  Expenses:Unknown  -50.00 EUR
+  Assets:PayPal  50.00 EUR
+`
+
+	buf := new(bytes.Buffer)
+	processCsvFile(strings.NewReader(file), config, "{{.Date}} {{printf \"%q\" .Payee}} {{printf \"%q\" .Narration}} {{.Tags}}{{range .Postings}}\n  {{.}}{{end}}\n", buf)
+
+	if buf.String() != want {
+		t.Errorf("got %v, want %v", buf.String(), want)
+	}
+}
+
+func TestMergePostings(t *testing.T) {
+	postings := []Posting{
+		{Account: "Assets:PayPal", Amount: mustDecimalPtr("-10.00"), Commodity: "USD"},
+		{Account: "Expenses:Games", Amount: mustDecimalPtr("10.00"), Commodity: "USD"},
+		{Account: "Assets:PayPal", Amount: mustDecimalPtr("10.00"), Commodity: "USD"},
+		{Account: "Assets:PayPal", Amount: mustDecimalPtr("-9.10"), Commodity: "EUR"},
+		{Account: "Assets:Broker:VWRL", Amount: mustDecimalPtr("1"), Commodity: "VWRL", Cost: &Cost{}},
+		{Account: "Income:Capital-Gains"},
+	}
+
+	want := []Posting{
+		{Account: "Expenses:Games", Amount: mustDecimalPtr("10.00"), Commodity: "USD"},
+		{Account: "Assets:PayPal", Amount: mustDecimalPtr("-9.10"), Commodity: "EUR"},
+		{Account: "Assets:Broker:VWRL", Amount: mustDecimalPtr("1"), Commodity: "VWRL", Cost: &Cost{}},
+		{Account: "Income:Capital-Gains"},
+	}
+
+	if ans := mergePostings(postings); !reflect.DeepEqual(ans, want) {
+		t.Errorf("got %v, want %v", ans, want)
+	}
+}
@@ -7,11 +7,13 @@ import (
 	"io/ioutil"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
 )
 
@@ -21,53 +23,125 @@ type Config struct {
 	TransactionsRules TransactionsRulesConfig
 }
 
-// TransactionsRulesConfig is a map of TransactionRule objects
-type TransactionsRulesConfig map[string]TransactionRule
+// TransactionsRulesConfig is an ordered list of TransactionRule objects
+type TransactionsRulesConfig []TransactionRule
 
 // TransactionRule is a set of values to match records with and update their values from
 type TransactionRule struct {
-	SetAccount       string
-	SetComment       string
+	Name             string            // The key identifying this rule
+	Priority         int               // Rules with a higher priority are evaluated first
+	Continue         bool              // Keep evaluating later rules after this one matched
+	Condition        Condition         // The conditions that have to hold as well as the match patterns
+	When             string            // An expression that has to hold as well as the match patterns
+	AddLinks         []string          // The links to add, without the leading ^
+	AddTags          []string          // The tags to add, without the leading #
+	SetAccount       string            // The account for the other side of the transaction
+	SetComment       string            // The comment
+	SetFlag          string            // The transaction flag, e.g. ! to mark it for review
+	SetMeta          map[string]string // The metadata to add
+	SetNarration     string            // The narration replacing the description
+	SetPayee         string            // The payee replacing the original one
+	Split            []SplitLeg        // The shares to split off the other side of the transaction
 	MatchDescription string
 	MatchPayee       string
+
+	when *expression // The compiled When expression
 }
 
 // CsvConfig is the config for parsing the csv file
 type CsvConfig struct {
-	AmountIn          int    // The amount in field index
-	AmountOut         int    // The amount out field index
-	Currency          string // The currency to use
-	Date              int    // The date field index
-	DateLayoutIn      string // The parsing format
-	DateLayoutOut     string // The date output format
-	DefaultAccount    string // The default account for transactions if no rule matches
-	Description       int    // The description field index
-	Fields            int    // Validate no. of fields; -1 is no check, 0 is infer from first row, and > 0 is explicit length
-	Payee             int    // The payee field index
-	ProcessingAccount string // The account this export/CSV pertains to
-	Separator         rune   // The csv file separator
-	Skip              int    // The number of csv rows to skip, excluding blank lines
-}
-
-// Record represents a financial transaction record
+	AmountIn           Column                    // The amount in field
+	AmountOut          Column                    // The amount out field
+	Balance            *Column                   // The running balance field, for balance assertions
+	BalanceAssertions  string                    // Where to assert the running balance; daily or end of file
+	Brokerage          *BrokerageConfig          // The brokerage config, for csv files with a trade on each row
+	Commodities        map[string]string         // The beancount commodities of asset names which aren't valid commodities, e.g. 1INCH
+	Currency           string                    // The currency to use
+	CurrencyColumn     *Column                   // The currency field, overriding the currency where it isn't empty
+	Date               Column                    // The date field
+	DateLayoutIn       string                    // The parsing format
+	DateLayoutOut      string                    // The date output format
+	DecimalSeparator   string                    // The decimal separator of amounts, detected from the amounts of the file if empty
+	DefaultAccount     string                    // The default account for transactions if no rule matches
+	Description        Column                    // The description field
+	Exchange           *ExchangeConfig           // The crypto exchange config, for csv files with a trade of a pair on each row
+	Fees               []Fee                     // The fee fields, each booked to its own account
+	Fields             int                       // Validate no. of fields; -1 is no check, 0 is infer from first row, and > 0 is explicit length
+	GroupBy            *Column                   // The field whose rows are merged into one transaction, e.g. a transaction id
+	Indicator          *Column                   // The debit/credit indicator field, for unsigned amounts
+	IndicatorCredit    []string                  // The indicator values of credits, e.g. H or CR
+	IndicatorDebit     []string                  // The indicator values of debits, e.g. S or DR
+	Locale             string                    // The locale preset for the separators of amounts, e.g. de_DE
+	NegativeStyle      string                    // How negative amounts are written; leading, trailing or parentheses, any of them if empty
+	OriginalAmount     *Column                   // The amount in the original currency field, e.g. for foreign card spend
+	OriginalCurrency   *Column                   // The original currency field
+	Payee              Column                    // The payee field
+	Postings           []PostingMap              // The postings of each row by amount field, instead of the amount in and out fields
+	Preamble           map[string]*regexp.Regexp // The patterns of values to extract from the lines above the csv table
+	ProcessingAccount  string                    // The account this export/CSV pertains to
+	ProcessingAccounts []ProcessingAccountRule   // Rules picking the processing account from the preamble values
+	QifDateLayout      string                    // The date format of qif files, the common ones being tried if empty
+	Separator          rune                      // The csv file separator
+	Sheet              string                    // The sheet of a spreadsheet to read, by name or number, the first one if empty
+	Skip               int                       // The number of csv rows to skip, excluding blank lines
+	SkipFooter         int                       // The number of csv rows to drop at the end of the file, excluding blank lines
+	SkipUntil          string                    // The pattern of the header row, all rows up to and including it are skipped
+	StopAt             string                    // The pattern of the first row after the transactions, it and all following rows are dropped
+	StripSymbols       []string                  // The currency symbols and other text to remove from amounts
+	Taxes              []Fee                     // The tax fields, each booked to its own account
+	ThousandsSeparator string                    // The thousands separator of amounts
+
+	header   []string          // The header row, once it has been read
+	preamble map[string]string // The values extracted from the preamble, once it has been read
+}
+
+// Record represents a financial transaction record, the AccountIn/AccountOut
+// and AmountIn/AmountOut pairs describe the two postings of a simple record
+// and are kept for existing templates, whereas Postings holds every posting
 type Record struct {
-	AccountIn   string // The account in
-	AccountOut  string // The acocunt out
-	AmountIn    string // The amount in
-	AmountOut   string // The amount out
-	Comment     string // The comment, if provided
-	Currency    string // The currency
-	Date        string // The date
-	Description string // The description, if present
-	Payee       string // The payee
-	Raw         string // The raw csv record
+	AccountIn        string            // The account in
+	AccountOut       string            // The acocunt out
+	AmountIn         string            // The amount in
+	AmountOut        string            // The amount out
+	Balance          string            // The running balance after this record, if provided
+	Comment          string            // The comment, if provided
+	Currency         string            // The currency
+	Date             string            // The date
+	Description      string            // The description, if present
+	Flag             string            // The transaction flag, * or !
+	Links            []string          // The links, without the leading ^
+	Meta             map[string]string // The transaction metadata
+	Narration        string            // The narration, defaults to the description
+	OriginalAmount   string            // The amount in the original currency, if provided
+	OriginalCurrency string            // The original currency, if provided
+	Payee            string            // The payee
+	Postings         []Posting         // The postings
+	Preamble         map[string]string // The values extracted from the lines above the csv table
+	Raw              string            // The raw csv record
+	Tags             []string          // The tags, without the leading #
+
+	amount  Decimal    // The signed amount, from the processing account's point of view
+	balance *Decimal   // The running balance, if provided
+	fields  []string   // The raw csv fields
+	group   string     // The group the record is merged into, if any
+	header  []string   // The csv header row, if known
+	split   []SplitLeg // The split legs of the matching rule, if any
+	trade   *trade     // The trade, for brokerage csv files
+	time    time.Time  // The parsed date
 }
 
 // RecordTemplate is the default template for formatting records
 const RecordTemplate = `;; {{ .Raw }}
-{{.Date}} * {{printf "%q" .Payee}} {{printf "%q" .Description}}
-  {{.AccountOut}}  {{.AmountOut}} {{.Currency}}
-  {{.AccountIn}}   {{.AmountIn}} {{.Currency}}
+{{.Date}} {{.Flag}} {{printf "%q" .Payee}} {{printf "%q" .Narration}}{{range .Tags}} #{{.}}{{end}}{{range .Links}} ^{{.}}{{end}}
+{{- if .Comment}}
+  ; {{.Comment}}
+{{- end}}
+{{- range $key, $value := .Meta}}
+  {{$key}}: {{printf "%q" $value}}
+{{- end}}
+{{- range .Postings}}
+  {{.}}
+{{- end}}
 
 `
 
@@ -96,30 +170,159 @@ func GetTemplate(file string) string {
 	return RecordTemplate
 }
 
-// getCsvReader ...
-func getCsvReader(file io.Reader, skip int, sep rune, fields int) *csv.Reader {
+// csvReader wraps a csv.Reader to stop at the end of the transactions
+// table, either at a row matching the stop pattern or a number of rows
+// before the end of the file
+type csvReader struct {
+	rows    rowReader      // The rows of the file
+	sep     rune           // The csv file separator
+	stopAt  *regexp.Regexp // The pattern of the first row after the table
+	footer  int            // The number of rows at the end of the file to drop
+	buffer  []csvRow       // The rows read ahead to detect the footer
+	stopped bool           // Whether the end of the table has been reached
+
+	preamble [][]string // The rows skipped before the table, including the header
+}
+
+// rowReader reads the rows of a file one by one, like a csv.Reader
+type rowReader interface {
+	Read() ([]string, error)
+}
+
+// csvRow is a row read ahead by the csvReader, along with its read error
+type csvRow struct {
+	record []string
+	err    error
+}
+
+// Read returns the next row of the transactions table
+func (r *csvReader) Read() ([]string, error) {
+	for !r.stopped && len(r.buffer) <= r.footer {
+		record, err := r.rows.Read()
+
+		if err == io.EOF {
+			r.stopped = true
+			break
+		}
+
+		// A footer row can easily have a different number of fields, so
+		//  check for it before surfacing any error the row caused.
+		if record != nil && r.stopAt != nil && r.stopAt.MatchString(joinRecord(record, r.sep)) {
+			log.WithFields(log.Fields{
+				"record": record,
+			}).Trace("stopped at row")
+
+			r.stopped = true
+			break
+		}
+
+		r.buffer = append(r.buffer, csvRow{record, err})
+	}
+
+	if len(r.buffer) <= r.footer {
+		return nil, io.EOF
+	}
+
+	row := r.buffer[0]
+	r.buffer = r.buffer[1:]
+
+	return row.record, row.err
+}
+
+// joinRecord turns a record back into a line, for matching patterns against
+func joinRecord(record []string, sep rune) string {
+	return strings.Join(record, string(sep))
+}
+
+// getCsvReader returns a reader positioned after the skipped rows, along
+// with the last skipped row which is taken to be the header row
+func getCsvReader(file io.Reader, config CsvConfig) (*csvReader, []string, error) {
 	r := csv.NewReader(file)
 
-	r.Comma = sep
+	r.Comma = config.Separator
 
 	// Force this setting initially, after skipping any records it's
-	//  updated with the user provided value or the default of 0.
+	// updated with the user provided value or the default of 0.
 	r.FieldsPerRecord = -1
 
+	reader, header, err := getTableReader(r, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r.FieldsPerRecord = config.Fields
+
+	return reader, header, nil
+}
+
+// getTableReader skips the rows before the transactions table, the same
+// way for csv files and spreadsheets, returning a reader positioned after
+// them along with the last skipped row
+func getTableReader(r rowReader, config CsvConfig) (*csvReader, []string, error) {
+	var header []string
+	var preamble [][]string
+
 	// Lines to skip at beginng of file, not including blank lines
+	skip := config.Skip
 	for skip > 0 {
-		if record, err := r.Read(); err != nil {
+		record, err := r.Read()
+		if err != nil {
 			log.WithFields(log.Fields{
 				"record": record,
 				"error":  err,
 			}).Trace("skipped line returned error")
 		}
+		if record != nil {
+			preamble = append(preamble, record)
+		}
+		header = record
 		skip = skip - 1
 	}
 
-	r.FieldsPerRecord = fields
+	// Then skip until the header row, however many lines away it may be
+	if config.SkipUntil != "" {
+		pattern, err := regexp.Compile(config.SkipUntil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid skip_until pattern: %w", err)
+		}
 
-	return r
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				return nil, nil, fmt.Errorf("no row matches skip_until pattern %q", config.SkipUntil)
+			} else if err != nil {
+				log.WithFields(log.Fields{
+					"record": record,
+					"error":  err,
+				}).Trace("skipped line returned error")
+			}
+
+			preamble = append(preamble, record)
+
+			if pattern.MatchString(joinRecord(record, config.Separator)) {
+				header = record
+				break
+			}
+		}
+	}
+
+	reader := &csvReader{
+		rows:     r,
+		sep:      config.Separator,
+		footer:   config.SkipFooter,
+		preamble: preamble,
+	}
+
+	if config.StopAt != "" {
+		pattern, err := regexp.Compile(config.StopAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid stop_at pattern: %w", err)
+		}
+
+		reader.stopAt = pattern
+	}
+
+	return reader, header, nil
 }
 
 // SetViperDefaults ...
@@ -134,6 +337,12 @@ func SetViperDefaults(cfgFile string) {
 	}
 
 	// Set config defaults
+	viper.SetDefault("csv.amount_in", "0")
+	viper.SetDefault("csv.amount_out", "0")
+	viper.SetDefault("csv.date", "0")
+	viper.SetDefault("csv.description", "0")
+	viper.SetDefault("csv.payee", "0")
+	viper.SetDefault("csv.balance_assertions", BalanceAssertionsEnd)
 	viper.SetDefault("csv.default_account", "Expenses:Unknown")
 	viper.SetDefault("csv.processing_account", "Assets:Unknown")
 	viper.SetDefault("csv.date_layout_out", "2006-01-02")
@@ -145,7 +354,62 @@ func SetViperDefaults(cfgFile string) {
 
 // ProcessCsvFile ...
 func ProcessCsvFile(file io.Reader, config Config, template string) {
-	r := getCsvReader(file, config.Csv.Skip, config.Csv.Separator, config.Csv.Fields)
+	processCsvFile(file, config, template, os.Stdout)
+}
+
+// processCsvFile ...
+func processCsvFile(file io.Reader, config Config, template string, output io.Writer) {
+	r, header, err := getCsvReader(file, config.Csv)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("error skipping to the csv table")
+	}
+
+	processTable(r, header, config, template, output)
+}
+
+// processTable converts the rows of a transactions table, its header being
+// the last skipped row or otherwise its first row
+func processTable(r *csvReader, header []string, config Config, template string, output io.Writer) {
+	if config.Csv.needsHeader() || config.TransactionsRules.needsHeader() {
+		// Without any skipped rows the header is the first row of the file
+		if header == nil {
+			var err error
+			if header, err = r.Read(); err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+				}).Fatal("error reading csv header")
+			}
+		}
+
+		csvConfig, err := config.Csv.resolveColumns(header)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"header": header,
+				"error":  err,
+			}).Fatal("error resolving csv columns")
+		}
+
+		rules, err := config.TransactionsRules.resolveColumns(header)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"header": header,
+				"error":  err,
+			}).Fatal("error resolving condition columns")
+		}
+
+		config.Csv = csvConfig
+		config.TransactionsRules = rules
+	}
+
+	config.Csv.header = header
+
+	config.Csv.preamble = extractPreamble(r.preamble, config.Csv)
+	config.Csv.ProcessingAccount = getProcessingAccount(config.Csv.preamble, config.Csv)
+
+	var rows [][]string
+	var amounts []string
 
 L:
 	for {
@@ -167,7 +431,40 @@ L:
 			}).Fatal("error while reading csv file")
 		}
 
-		parseCsvRecord(record, config, template, os.Stdout)
+		rows = append(rows, record)
+		amounts = append(amounts, config.Csv.amountValues(record)...)
+	}
+
+	csvConfig, err := detectSeparators(amounts, config.Csv)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("error detecting the separators of the amounts")
+	}
+
+	config.Csv = csvConfig
+
+	var records []Record
+	for _, row := range rows {
+		records = append(records, formatRecord(row, config))
+	}
+
+	if config.Csv.Brokerage != nil && config.Csv.Brokerage.Booking == BookingFIFO {
+		bookLots(records)
+	}
+
+	if config.Csv.GroupBy != nil {
+		records = groupRecords(records)
+	}
+
+	balances := getBalances(records, config.Csv)
+
+	for i, record := range records {
+		renderRecord(record, template, output)
+
+		if balance, ok := balances[i]; ok {
+			renderBalance(balance, output)
+		}
 	}
 }
 
@@ -175,53 +472,165 @@ L:
 func GetConfig() Config {
 	return Config{
 		Csv: CsvConfig{
-			AmountIn:          viper.GetInt("csv.amount_in"),
-			AmountOut:         viper.GetInt("csv.amount_out"),
-			Currency:          viper.GetString("csv.currency"),
-			Date:              viper.GetInt("csv.date"),
-			DateLayoutIn:      viper.GetString("csv.date_layout_in"),
-			DateLayoutOut:     viper.GetString("csv.date_layout_out"),
-			DefaultAccount:    viper.GetString("csv.default_account"),
-			Description:       viper.GetInt("csv.description"),
-			Fields:            viper.GetInt("csv.fields"),
-			Payee:             viper.GetInt("csv.payee"),
-			ProcessingAccount: viper.GetString("csv.processing_account"),
-			Separator:         []rune(viper.GetString("csv.separator"))[0],
-			Skip:              viper.GetInt("csv.skip"),
+			AmountIn:           getColumn("csv.amount_in"),
+			AmountOut:          getColumn("csv.amount_out"),
+			Balance:            getOptionalColumn("csv.balance"),
+			BalanceAssertions:  viper.GetString("csv.balance_assertions"),
+			Brokerage:          getBrokerage(),
+			Commodities:        getCommodities(viper.GetStringMapString("csv.commodities")),
+			Currency:           viper.GetString("csv.currency"),
+			CurrencyColumn:     getOptionalColumn("csv.currency_column"),
+			Date:               getColumn("csv.date"),
+			DateLayoutIn:       viper.GetString("csv.date_layout_in"),
+			DateLayoutOut:      viper.GetString("csv.date_layout_out"),
+			DecimalSeparator:   viper.GetString("csv.decimal_separator"),
+			DefaultAccount:     viper.GetString("csv.default_account"),
+			Description:        getColumn("csv.description"),
+			Exchange:           getExchange(),
+			Fees:               getFees("csv.fees", viper.Get("csv.fees")),
+			Fields:             viper.GetInt("csv.fields"),
+			GroupBy:            getOptionalColumn("csv.group_by"),
+			Indicator:          getOptionalColumn("csv.indicator"),
+			IndicatorCredit:    viper.GetStringSlice("csv.indicator_credit"),
+			IndicatorDebit:     viper.GetStringSlice("csv.indicator_debit"),
+			Locale:             viper.GetString("csv.locale"),
+			NegativeStyle:      viper.GetString("csv.negative_style"),
+			OriginalAmount:     getOptionalColumn("csv.original_amount"),
+			OriginalCurrency:   getOptionalColumn("csv.original_currency"),
+			Payee:              getColumn("csv.payee"),
+			Postings:           getPostingMaps(viper.Get("csv.postings")),
+			Preamble:           getPreamble(viper.GetStringMapString("csv.preamble")),
+			ProcessingAccount:  viper.GetString("csv.processing_account"),
+			ProcessingAccounts: getProcessingAccountRules(viper.Get("csv.processing_accounts")),
+			QifDateLayout:      viper.GetString("csv.qif_date_layout"),
+			Separator:          []rune(viper.GetString("csv.separator"))[0],
+			Sheet:              viper.GetString("csv.sheet"),
+			Skip:               viper.GetInt("csv.skip"),
+			SkipFooter:         viper.GetInt("csv.skip_footer"),
+			SkipUntil:          viper.GetString("csv.skip_until"),
+			StopAt:             viper.GetString("csv.stop_at"),
+			StripSymbols:       viper.GetStringSlice("csv.strip_symbols"),
+			Taxes:              getFees("csv.taxes", viper.Get("csv.taxes")),
+			ThousandsSeparator: viper.GetString("csv.thousands_separator"),
 		},
-		TransactionsRules: getTransactionsRules(viper.GetStringMapString("transactions_rules")),
+		TransactionsRules: getTransactionsRules(viper.Get("transactions_rules")),
 	}
 }
 
-// getTransactionsRules ...
-func getTransactionsRules(keys map[string]string) (rules TransactionsRulesConfig) {
-	// rules = make(map[string]map[string]string)
-	rules = make(TransactionsRulesConfig)
+// getTransactionsRules builds the ordered list of rules, which can be given
+// either as a list (evaluated in the order written) or as a map (evaluated
+// in the order of their keys). In both cases a higher priority moves a rule
+// ahead of the others, so the evaluation order never depends on map order.
+func getTransactionsRules(value interface{}) (rules TransactionsRulesConfig) {
+	rules = TransactionsRulesConfig{}
+
+	switch value := value.(type) {
+	case []interface{}:
+		for i, item := range value {
+			rule := getStringMap(item)
+			name := cast.ToString(rule["name"])
+
+			if name == "" {
+				name = fmt.Sprintf("%d", i)
+			}
 
-	for key := range keys {
-		rules[key] = getTransactionRule(viper.GetStringMapString(fmt.Sprintf("transactions_rules.%s", key)))
+			rules = append(rules, getTransactionRule(name, rule))
+		}
+	default:
+		keys := getStringMap(value)
+		names := make([]string, 0, len(keys))
+
+		for key := range keys {
+			names = append(names, key)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			rules = append(rules, getTransactionRule(name, getStringMap(keys[name])))
+		}
 	}
 
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Priority > rules[j].Priority
+	})
+
 	return rules
 }
 
-func getTransactionRule(rule map[string]string) TransactionRule {
+func getTransactionRule(name string, rule map[string]interface{}) TransactionRule {
+	var when *expression
+
+	if source := cast.ToString(rule["when"]); source != "" {
+		var err error
+		if when, err = compileExpression(source); err != nil {
+			log.WithFields(log.Fields{
+				"rule":  name,
+				"when":  source,
+				"error": err,
+			}).Fatal("error compiling rule expression")
+		}
+	}
+
 	return TransactionRule{
-		SetAccount:       rule["set_account"],
-		SetComment:       rule["set_comment"],
-		MatchDescription: rule["match_description"],
-		MatchPayee:       rule["match_payee"],
+		Name:             name,
+		Priority:         cast.ToInt(rule["priority"]),
+		Continue:         cast.ToBool(rule["continue"]),
+		Condition:        getCondition(name, rule),
+		AddLinks:         getRuleList(rule["add_links"], "^"),
+		AddTags:          getRuleList(rule["add_tags"], "#"),
+		SetAccount:       cast.ToString(rule["set_account"]),
+		SetComment:       cast.ToString(rule["set_comment"]),
+		SetFlag:          cast.ToString(rule["set_flag"]),
+		SetMeta:          getRuleMeta(rule["set_meta"]),
+		SetNarration:     cast.ToString(rule["set_narration"]),
+		SetPayee:         cast.ToString(rule["set_payee"]),
+		Split:            getSplit(name, rule["split"]),
+		When:             cast.ToString(rule["when"]),
+		MatchDescription: cast.ToString(rule["match_description"]),
+		MatchPayee:       cast.ToString(rule["match_payee"]),
+		when:             when,
+	}
+}
+
+// getRuleList reads a list of tags or links, given either as a list or as
+// a space separated string, and with or without their prefix
+func getRuleList(value interface{}, prefix string) (list []string) {
+	for _, item := range cast.ToStringSlice(value) {
+		list = append(list, strings.TrimPrefix(item, prefix))
+	}
+
+	return list
+}
+
+// getRuleMeta ...
+func getRuleMeta(value interface{}) map[string]string {
+	meta := cast.ToStringMapString(value)
+	if len(meta) == 0 {
+		return nil
 	}
+
+	return meta
 }
 
-// parseCsvRecord ...
-func parseCsvRecord(record []string, config Config, tplString string, output io.Writer) {
-	recordType := formatRecord(record, config)
+// getStringMap converts a config value into a map with lower cased keys,
+// the same way viper treats the keys it loads itself.
+func getStringMap(value interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+
+	for key, val := range cast.ToStringMap(value) {
+		m[strings.ToLower(key)] = val
+	}
 
+	return m
+}
+
+// renderRecord ...
+func renderRecord(record Record, tplString string, output io.Writer) {
 	// Create a new template and parse the letter into it.
 	t := template.Must(template.New("transaction").Parse(tplString))
 
-	err := t.Execute(output, recordType)
+	err := t.Execute(output, record)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
@@ -231,88 +640,292 @@ func parseCsvRecord(record []string, config Config, tplString string, output io.
 
 // formatRecord ...
 func formatRecord(record []string, config Config) Record {
-	var accountIn, accountOut, amountIn, amountOut, comment, currency, date, description, payee, raw string
+	var currency, date, description, payee, raw string
 
-	t, err := time.Parse(config.Csv.DateLayoutIn, record[config.Csv.Date])
+	t, err := time.Parse(config.Csv.DateLayoutIn, config.Csv.Date.value(record))
 	if err != nil {
 		log.WithFields(log.Fields{
 			"config.Csv.DateLayoutIn": config.Csv.DateLayoutIn,
-			"record[config.Csv.Date]": record[config.Csv.Date],
+			"record[config.Csv.Date]": config.Csv.Date.value(record),
 			"error":                   err,
 		}).Warn("error parsing date")
 	}
 
 	date = fmt.Sprint(t.Format(config.Csv.DateLayoutOut))
 
-	payee = record[config.Csv.Payee]
+	payee = config.Csv.Payee.value(record)
 	currency = config.Csv.Currency
-	description = record[config.Csv.Description]
+	if value := strings.TrimSpace(config.Csv.CurrencyColumn.value(record)); value != "" {
+		currency = value
+	}
+
+	description = config.Csv.Description.value(record)
 	raw = fmt.Sprintf("%#v", record)
 
-	var amount string
+	var amount Decimal
+	var mapped []Posting
+	var trade *trade
+
+	if config.Csv.Brokerage != nil {
+		trade, err = getTrade(record, config.Csv, currency)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"record": record,
+				"error":  err,
+			}).Fatal("error parsing trade")
+		}
+	}
 
-	if config.Csv.AmountIn != config.Csv.AmountOut {
+	var exchangeTrade *exchangeTrade
+
+	if config.Csv.Exchange != nil {
+		exchangeTrade, err = getExchangeTrade(record, config.Csv)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"record": record,
+				"error":  err,
+			}).Fatal("error parsing exchange trade")
+		}
+	}
+
+	if exchangeTrade != nil {
+		// the fiat paid or received
+		amount = exchangeTrade.amount(config.Csv)
+	} else if trade != nil {
+		// the cash leg of a buy or a sell, fees included
+		_, charged := feePostings(record, config.Csv, currency)
+		amount = trade.cash(charged)
+	} else if len(config.Csv.Postings) > 0 {
+		// a posting per amount column
+		mapped, amount, err = mapPostings(record, config.Csv, currency)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"record": record,
+				"error":  err,
+			}).Fatal("error mapping postings")
+		}
+	} else if config.Csv.AmountIn.Index != config.Csv.AmountOut.Index {
 		// explicit amountIn and amountOut fields
-		if record[config.Csv.AmountIn] != "" {
-			amount = formatAmount(record[config.Csv.AmountIn])
-		} else if record[config.Csv.AmountOut] != "" {
-			amount = fmt.Sprintf("-%s", record[config.Csv.AmountOut])
+		if config.Csv.AmountIn.value(record) != "" {
+			amount = parseRecordAmount(config.Csv.AmountIn.value(record), record, config.Csv)
+		} else if config.Csv.AmountOut.value(record) != "" {
+			amount = parseRecordAmount(config.Csv.AmountOut.value(record), record, config.Csv).Abs().Neg()
 		}
-	} else if config.Csv.AmountIn == config.Csv.AmountOut {
+	} else {
 		// single amount field with signs to indicate transaction type
-		amount = formatAmount(record[config.Csv.AmountIn])
+		amount = parseRecordAmount(config.Csv.AmountIn.value(record), record, config.Csv)
+	}
+
+	if trade == nil && exchangeTrade == nil && len(config.Csv.Postings) == 0 && config.Csv.Indicator != nil {
+		amount, err = applyIndicator(amount, config.Csv.Indicator.value(record), config.Csv)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"record": record,
+				"error":  err,
+			}).Fatal("error parsing debit/credit indicator")
+		}
+	}
+
+	var balance *Decimal
+
+	if config.Csv.Balance.value(record) != "" {
+		b := parseRecordAmount(config.Csv.Balance.value(record), record, config.Csv)
+		balance = &b
+	}
+
+	var original *Decimal
+
+	originalCurrency := strings.TrimSpace(config.Csv.OriginalCurrency.value(record))
+	if value := config.Csv.OriginalAmount.value(record); value != "" {
+		o := parseRecordAmount(value, record, config.Csv)
+		original = &o
 	}
 
+	r := Record{
+		Currency:         currency,
+		Date:             date,
+		Description:      description,
+		Flag:             FlagComplete,
+		Meta:             map[string]string{},
+		Narration:        description,
+		OriginalCurrency: originalCurrency,
+		Payee:            payee,
+		Preamble:         config.Csv.preamble,
+		Raw:              raw,
+		amount:           amount,
+		balance:          balance,
+		fields:           record,
+		group:            strings.TrimSpace(config.Csv.GroupBy.value(record)),
+		header:           config.Csv.header,
+		time:             t,
+		trade:            trade,
+	}
+
+	if balance != nil {
+		r.Balance = balance.String()
+	}
+
+	if original != nil {
+		r.OriginalAmount = original.String()
+	}
+
+	// the legacy fields hold the amount as seen from either side
+	r.AmountIn = amount.Abs().String()
+	r.AmountOut = amount.Abs().Neg().String()
+
 	// check the amount sign to determine the transaction type
-	if regexp.MustCompile(`^-`).Match([]byte(amount)) {
+	debit := amount.Sign() < 0
+
+	if debit {
 		// it's a debit
-		amountOut = amount
-		amountIn = strings.ReplaceAll(amount, "-", "")
-		accountOut = config.Csv.ProcessingAccount
-		accountIn = config.Csv.DefaultAccount
+		r.AccountOut = config.Csv.ProcessingAccount
+		r.AccountIn = config.Csv.DefaultAccount
 
-		checkRules(config, payee, description, &accountIn, &comment)
+		checkRules(config, &r, &r.AccountIn)
 	} else {
 		// it's a credit
-		amountIn = amount
-		amountOut = fmt.Sprintf("-%s", amount)
-		accountIn = config.Csv.ProcessingAccount
-		accountOut = config.Csv.DefaultAccount
+		r.AccountIn = config.Csv.ProcessingAccount
+		r.AccountOut = config.Csv.DefaultAccount
 
-		checkRules(config, payee, description, &accountOut, &comment)
+		checkRules(config, &r, &r.AccountOut)
 	}
 
-	return Record{
-		AccountIn:   accountIn,
-		AccountOut:  accountOut,
-		AmountIn:    amountIn,
-		AmountOut:   amountOut,
-		Comment:     comment,
-		Currency:    currency,
-		Date:        date,
-		Description: description,
-		Payee:       payee,
-		Raw:         raw,
+	if len(mapped) > 0 {
+		r.Postings = accountPostings(mapped, counterAccount(r, debit))
+
+		return r
 	}
+
+	if exchangeTrade != nil {
+		r.Postings = exchangeTrade.postings(config.Csv)
+
+		return r
+	}
+
+	if trade != nil {
+		fees, charged := feePostings(record, config.Csv, currency)
+		r.Postings = trade.postings(fees, charged, config.Csv)
+
+		return r
+	}
+
+	amountIn, amountOut := amount.Abs(), amount.Abs().Neg()
+
+	out := Posting{Account: r.AccountOut, Amount: &amountOut, Commodity: currency}
+	in := Posting{Account: r.AccountIn, Amount: &amountIn, Commodity: currency}
+
+	// foreign spend is recorded in its original currency on the other side,
+	// converted at its total price on the processing account's side
+	if original != nil && !original.IsZero() && originalCurrency != "" && originalCurrency != currency {
+		if debit {
+			convertPostings(&out, &in, *original, originalCurrency)
+		} else {
+			convertPostings(&in, &out, *original, originalCurrency)
+		}
+	}
+
+	// fees and taxes come out of the processing account on top of the amount
+	fees, charged := feePostings(record, config.Csv, currency)
+	if debit {
+		fees = chargeFees(&out, fees, charged)
+	} else {
+		fees = chargeFees(&in, fees, charged)
+	}
+
+	if len(r.split) == 0 {
+		r.Postings = []Posting{out, in}
+	} else if debit {
+		r.Postings = append([]Posting{out}, splitRecordPosting(in, r.split)...)
+	} else {
+		r.Postings = append(splitRecordPosting(out, r.split), in)
+	}
+
+	r.Postings = append(r.Postings, fees...)
+
+	return r
 }
 
-// checkRules ...
-func checkRules(config Config, payee, description string, account, comment *string) {
-	for key := range config.TransactionsRules {
+// checkRules evaluates the rules in order, the first matching rule wins
+// unless it sets continue, in which case later rules are evaluated too.
+// Rules always match against the original payee and description, even
+// after an earlier rule has rewritten them.
+func checkRules(config Config, record *Record, account *string) {
+	payee, description := record.Payee, record.Description
+
+	for _, rule := range config.TransactionsRules {
 		log.WithFields(log.Fields{
 			"description": description,
 			"payee":       payee,
-			"key":         key,
-			"rule":        fmt.Sprintf("%#v", config.TransactionsRules[key]),
+			"key":         rule.Name,
+			"rule":        fmt.Sprintf("%#v", rule),
 		}).Debug("iterating over rules")
 
-		if checkRule(config.TransactionsRules[key].MatchPayee, payee) || checkRule(config.TransactionsRules[key].MatchDescription, description) {
-			applyRuleSetting(config.TransactionsRules[key].SetAccount, account)
-			applyRuleSetting(config.TransactionsRules[key].SetComment, comment)
+		if match, ok := rule.check(record, payee, description); ok {
+			applyRuleSetting(match.expand(rule.SetAccount), account)
+			applyRuleSetting(match.expand(rule.SetComment), &record.Comment)
+			applyRuleSetting(rule.SetFlag, &record.Flag)
+			applyRuleSetting(match.expand(rule.SetNarration), &record.Narration)
+			applyRuleSetting(match.expand(rule.SetPayee), &record.Payee)
+			applyRuleList(rule.AddTags, &record.Tags)
+			applyRuleList(rule.AddLinks, &record.Links)
+			applyRuleMeta(rule.SetMeta, record.Meta)
+
+			if len(rule.Split) > 0 {
+				record.split = rule.Split
+			}
+
+			if !rule.Continue {
+				break
+			}
 		}
 	}
 }
 
+// check matches a rule against a record, either match pattern has to match
+// when one is set, and the condition tree and expression have to hold when
+// they are set
+func (rule TransactionRule) check(record *Record, payee, description string) (ruleMatch, bool) {
+	var match ruleMatch
+	var ok bool
+
+	if rule.MatchPayee != "" || rule.MatchDescription != "" {
+		match, ok = checkRule(rule.MatchPayee, payee)
+		if !ok {
+			match, ok = checkRule(rule.MatchDescription, description)
+		}
+
+		if !ok {
+			return match, false
+		}
+	} else if rule.Condition.isEmpty() && rule.when == nil {
+		// rules without anything to match never match
+		return match, false
+	}
+
+	// The condition sees the original payee and description too
+	original := *record
+	original.Payee, original.Description = payee, description
+
+	if !rule.Condition.check(&original, &match) {
+		return match, false
+	}
+
+	if rule.when != nil {
+		ok, err := rule.when.evalBool(getExpressionEnvironment(&original))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"rule":  rule.Name,
+				"when":  rule.When,
+				"error": err,
+			}).Warn("error evaluating rule expression")
+		}
+
+		return match, ok
+	}
+
+	return match, true
+}
+
 // applyRuleSetting ...
 func applyRuleSetting(setting string, value *string) {
 	if setting != "" {
@@ -320,32 +933,84 @@ func applyRuleSetting(setting string, value *string) {
 	}
 }
 
+// applyRuleList appends the items not already in the list
+func applyRuleList(items []string, list *[]string) {
+L:
+	for _, item := range items {
+		for _, existing := range *list {
+			if existing == item {
+				continue L
+			}
+		}
+
+		*list = append(*list, item)
+	}
+}
+
+// applyRuleMeta ...
+func applyRuleMeta(setting, meta map[string]string) {
+	for key, value := range setting {
+		meta[key] = value
+	}
+}
+
+// ruleMatch is the regular expression match of a rule, which the rule's
+// settings can refer to with $1 or ${name} style substitutions
+type ruleMatch struct {
+	pattern *regexp.Regexp
+	str     string
+	indices []int
+}
+
+// expand substitutes the capture groups of the match into a setting
+func (m ruleMatch) expand(setting string) string {
+	if m.pattern == nil || !strings.Contains(setting, "$") {
+		return setting
+	}
+
+	return string(m.pattern.ExpandString(nil, setting, m.str, m.indices))
+}
+
 // checkRule ...
-func checkRule(expression, str string) bool {
+func checkRule(expression, str string) (ruleMatch, bool) {
 	if expression == "" {
 		// empty expressions will always match, so skip them
-		return false
+		return ruleMatch{}, false
 	}
 
-	match := regexp.MustCompile(expression).FindString(str)
+	return matchRule(regexp.MustCompile(expression), str)
+}
+
+// matchRule matches a compiled pattern of a rule against a string
+func matchRule(pattern *regexp.Regexp, str string) (ruleMatch, bool) {
+	indices := pattern.FindStringSubmatchIndex(str)
+
+	var match string
+	if indices != nil {
+		match = str[indices[0]:indices[1]]
+	}
 
 	log.WithFields(log.Fields{
-		"expression": expression,
+		"expression": pattern.String(),
 		"str":        str,
 		"match":      match,
 	}).Trace("checked rule")
 
 	// Return bool indicating if match was not empty
-	return match != ""
+	return ruleMatch{pattern, str, indices}, match != ""
 }
 
-// formatAmount ...
-func formatAmount(val string) string {
-	// comma as the decimal separator
-	if regexp.MustCompile(`,\d{2}$`).Match([]byte(val)) {
-		val = strings.ReplaceAll(val, ".", "")
-		val = strings.ReplaceAll(val, ",", ".")
+// parseRecordAmount parses an amount of a csv record, stopping the
+// conversion if it can't be parsed rather than writing a wrong transaction
+func parseRecordAmount(val string, record []string, config CsvConfig) Decimal {
+	amount, err := parseAmount(val, config)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"amount": val,
+			"record": record,
+			"error":  err,
+		}).Fatal("error parsing amount")
 	}
 
-	return val
+	return amount
 }
@@ -34,16 +34,16 @@ transactions_rules:
 `
 
 var DefaultCsvConfig = CsvConfig{
-	AmountIn:          0,
-	AmountOut:         0,
+	AmountIn:          Column{Index: 0},
+	AmountOut:         Column{Index: 0},
 	Currency:          "EUR",
-	Date:              0,
+	Date:              Column{Index: 0},
 	DateLayoutIn:      "",
 	DateLayoutOut:     "",
 	DefaultAccount:    "",
-	Description:       0,
+	Description:       Column{Index: 0},
 	Fields:            0,
-	Payee:             0,
+	Payee:             Column{Index: 0},
 	ProcessingAccount: "",
 	Separator:         []rune(";")[0],
 	Skip:              0,
@@ -51,22 +51,24 @@ var DefaultCsvConfig = CsvConfig{
 
 var DefaultConfigExample1 = Config{
 	Csv: CsvConfig{
-		AmountIn:          7,
-		AmountOut:         7,
+		AmountIn:          Column{Index: 7},
+		AmountOut:         Column{Index: 7},
+		BalanceAssertions: "end",
 		Currency:          "EUR",
-		Date:              0,
+		Date:              Column{Index: 0},
 		DateLayoutIn:      "02.01.2006",
 		DateLayoutOut:     "2006-01-02",
 		DefaultAccount:    "Expenses:Unknown",
-		Description:       4,
+		Description:       Column{Index: 4},
 		Fields:            0,
-		Payee:             2,
+		Payee:             Column{Index: 2},
 		ProcessingAccount: "Assets:Unknown",
 		Separator:         ';',
 		Skip:              10,
 	},
 	TransactionsRules: TransactionsRulesConfig{
-		"blah": TransactionRule{
+		TransactionRule{
+			Name:             "blah",
 			SetAccount:       "set_account",
 			SetComment:       "set_comment",
 			MatchDescription: "match_description",
@@ -112,6 +114,7 @@ func TestGetCsvReader(t *testing.T) {
 		sep    rune
 		fields int
 		err    error
+		header []string
 		want   []string
 	}{
 		{
@@ -121,6 +124,7 @@ func TestGetCsvReader(t *testing.T) {
 			',',
 			-1,
 			nil,
+			nil,
 			[]string{"first_name", "last_name", "username"},
 		},
 		{
@@ -130,6 +134,7 @@ func TestGetCsvReader(t *testing.T) {
 			';',
 			-1,
 			nil,
+			[]string{"In der CSV-Datei finden Sie alle bereits gebuchten Ums<E4>tze. Die vorgemerkten Ums<E4>tze werden nicht aufgenommen, auch wenn sie in Ihrem Internetbanking angezeigt werden."},
 			[]string{"Buchung", "Valuta", "Auftraggeber/Empf<E4>nger", "Buchungstext", "Verwendungszweck", "Saldo", "W<E4>hrung", "Betrag", "W<E4>hrung"},
 		},
 	}
@@ -137,12 +142,114 @@ func TestGetCsvReader(t *testing.T) {
 	for _, tt := range tests {
 		testname := tt.name
 		t.Run(testname, func(t *testing.T) {
-			r := getCsvReader(tt.file, tt.skip, tt.sep, tt.fields)
+			r, header, err := getCsvReader(tt.file, CsvConfig{Skip: tt.skip, Separator: tt.sep, Fields: tt.fields})
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
 			record, err := r.Read()
 
 			if !reflect.DeepEqual(record, tt.want) || err != tt.err {
 				t.Errorf("got %v and %v, want %v and %v", record, err, tt.want, tt.err)
 			}
+
+			if !reflect.DeepEqual(header, tt.header) {
+				t.Errorf("got header %v, want %v", header, tt.header)
+			}
+		})
+	}
+}
+
+func TestCsvReaderTable(t *testing.T) {
+	footer := INGDiBaCsvFile + "\nSumme;;;;;;;-80,79;EUR\nExportiert;28.03.2020\n"
+
+	var tests = []struct {
+		name   string
+		file   string
+		config CsvConfig
+		header string
+		first  string
+		last   string
+		rows   int
+		err    bool
+	}{
+		{
+			"test #1 skip until the header row",
+			INGDiBaCsvFile,
+			CsvConfig{Separator: ';', SkipUntil: "^Buchung;Valuta;"},
+			"Buchung",
+			"26.04.2019",
+			"23.04.2019",
+			6,
+			false,
+		},
+		{
+			"test #2 skip and skip until combined",
+			INGDiBaCsvFile,
+			CsvConfig{Separator: ';', Skip: 3, SkipUntil: "^Buchung;"},
+			"Buchung",
+			"26.04.2019",
+			"23.04.2019",
+			6,
+			false,
+		},
+		{
+			"test #3 stop at the totals row",
+			footer,
+			CsvConfig{Separator: ';', SkipUntil: "^Buchung;", StopAt: "^Summe;"},
+			"Buchung",
+			"26.04.2019",
+			"23.04.2019",
+			6,
+			false,
+		},
+		{
+			"test #4 skip the footer rows",
+			footer,
+			CsvConfig{Separator: ';', SkipUntil: "^Buchung;", SkipFooter: 2, Fields: -1},
+			"Buchung",
+			"26.04.2019",
+			"23.04.2019",
+			6,
+			false,
+		},
+		{
+			"test #5 header row not found",
+			INGDiBaCsvFile,
+			CsvConfig{Separator: ';', SkipUntil: "^Date,"},
+			"",
+			"",
+			"",
+			0,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, header, err := getCsvReader(strings.NewReader(tt.file), tt.config)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			var records [][]string
+			for {
+				record, err := r.Read()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("got error %v", err)
+				}
+				records = append(records, record)
+			}
+
+			if header[0] != tt.header || len(records) != tt.rows || records[0][0] != tt.first || records[len(records)-1][0] != tt.last {
+				t.Errorf("got header %v and %d rows %v, want %v and %d rows", header, len(records), records, tt.header, tt.rows)
+			}
 		})
 	}
 }
@@ -194,7 +301,8 @@ func TestCheckRules(t *testing.T) {
 			Config{
 				Csv: DefaultCsvConfig,
 				TransactionsRules: TransactionsRulesConfig{
-					"TEST": TransactionRule{
+					TransactionRule{
+						Name:             "TEST",
 						SetAccount:       "updated_account",
 						SetComment:       "updated_comment",
 						MatchDescription: "",
@@ -207,13 +315,15 @@ func TestCheckRules(t *testing.T) {
 			Config{
 				Csv: DefaultCsvConfig,
 				TransactionsRules: TransactionsRulesConfig{
-					"TEST": TransactionRule{
+					TransactionRule{
+						Name:             "TEST",
 						SetAccount:       "updated_account",
 						SetComment:       "updated_comment",
 						MatchDescription: "description",
 						MatchPayee:       "",
 					},
-					"TEST2": TransactionRule{
+					TransactionRule{
+						Name:             "TEST2",
 						SetAccount:       "wont match",
 						SetComment:       "",
 						MatchDescription: "",
@@ -222,14 +332,194 @@ func TestCheckRules(t *testing.T) {
 				},
 			}, "some payee", "description", "default_account", "default_comment", "updated_account", "updated_comment",
 		},
+		{"test #3: first match wins",
+			Config{
+				Csv: DefaultCsvConfig,
+				TransactionsRules: TransactionsRulesConfig{
+					TransactionRule{
+						Name:       "FIRST",
+						SetAccount: "first_account",
+						MatchPayee: "payee",
+					},
+					TransactionRule{
+						Name:       "SECOND",
+						SetAccount: "second_account",
+						SetComment: "second_comment",
+						MatchPayee: "payee",
+					},
+				},
+			}, "payee", "some description", "default_account", "default_comment", "first_account", "default_comment",
+		},
+		{"test #4: continue to later rules",
+			Config{
+				Csv: DefaultCsvConfig,
+				TransactionsRules: TransactionsRulesConfig{
+					TransactionRule{
+						Name:       "FIRST",
+						Continue:   true,
+						SetAccount: "first_account",
+						MatchPayee: "payee",
+					},
+					TransactionRule{
+						Name:       "SECOND",
+						SetComment: "second_comment",
+						MatchPayee: "payee",
+					},
+				},
+			}, "payee", "some description", "default_account", "default_comment", "first_account", "second_comment",
+		},
 	}
 
 	for _, tt := range tests {
 		testname := tt.name
 		t.Run(testname, func(t *testing.T) {
-			checkRules(tt.conf, tt.payee, tt.desc, &tt.account, &tt.comment)
-			if tt.account != tt.wantAccount || tt.comment != tt.wantComment {
-				t.Errorf("got %v and %v, wanted %v and %v", tt.account, tt.comment, tt.wantAccount, tt.wantComment)
+			record := Record{Payee: tt.payee, Description: tt.desc, Comment: tt.comment, Meta: map[string]string{}}
+			checkRules(tt.conf, &record, &tt.account)
+			if tt.account != tt.wantAccount || record.Comment != tt.wantComment {
+				t.Errorf("got %v and %v, wanted %v and %v", tt.account, record.Comment, tt.wantAccount, tt.wantComment)
+			}
+		})
+	}
+}
+
+func TestGetTransactionsRules(t *testing.T) {
+	var tests = []struct {
+		name string
+		conf string
+		want []string
+	}{
+		{
+			"test #1 map sorted by key",
+			`transactions_rules:
+  zulu:
+    set_account: "z"
+  alpha:
+    set_account: "a"
+  mike:
+    set_account: "m"
+`,
+			[]string{"alpha", "mike", "zulu"},
+		},
+		{
+			"test #2 map sorted by priority then key",
+			`transactions_rules:
+  zulu:
+    priority: 10
+  alpha:
+    set_account: "a"
+  mike:
+    priority: -1
+  bravo:
+    priority: 10
+`,
+			[]string{"bravo", "zulu", "alpha", "mike"},
+		},
+		{
+			"test #3 list keeps written order",
+			`transactions_rules:
+  - name: zulu
+  - name: alpha
+  - set_account: "unnamed"
+  - name: mike
+    priority: 1
+`,
+			[]string{"mike", "zulu", "alpha", "2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			SetViperDefaults("")
+
+			err := viper.ReadConfig(strings.NewReader(tt.conf))
+			if err != nil {
+				fmt.Println("Error reading config: ", err)
+			}
+
+			var names []string
+			for _, rule := range getTransactionsRules(viper.Get("transactions_rules")) {
+				names = append(names, rule.Name)
+			}
+
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRulesActions(t *testing.T) {
+	config := Config{
+		Csv: DefaultCsvConfig,
+		TransactionsRules: TransactionsRulesConfig{
+			TransactionRule{
+				Name:       "VISA",
+				Continue:   true,
+				AddTags:    []string{"visa"},
+				AddLinks:   []string{"statement-2019-04"},
+				SetMeta:    map[string]string{"card": "visa"},
+				MatchPayee: "^VISA ",
+			},
+			TransactionRule{
+				Name:       "REWE",
+				AddTags:    []string{"visa", "food"},
+				SetAccount: "Expenses:Groceries",
+				SetFlag:    "!",
+				SetMeta:    map[string]string{"category": "groceries"},
+				SetPayee:   "REWE",
+				MatchPayee: "REWE MARKT",
+			},
+			TransactionRule{
+				Name:         "UNREACHED",
+				SetNarration: "unreached",
+				MatchPayee:   "REWE",
+			},
+		},
+	}
+
+	record := Record{
+		Payee:       "VISA REWE MARKT GMBH-ZWNL O",
+		Description: "NR8412345615 BERLIN KAUFUMSATZ",
+		Flag:        FlagComplete,
+		Narration:   "NR8412345615 BERLIN KAUFUMSATZ",
+		Meta:        map[string]string{},
+	}
+	account := "Expenses:Unknown"
+
+	want := Record{
+		Payee:       "REWE",
+		Description: "NR8412345615 BERLIN KAUFUMSATZ",
+		Flag:        "!",
+		Narration:   "NR8412345615 BERLIN KAUFUMSATZ",
+		Tags:        []string{"visa", "food"},
+		Links:       []string{"statement-2019-04"},
+		Meta:        map[string]string{"card": "visa", "category": "groceries"},
+	}
+
+	checkRules(config, &record, &account)
+
+	if !reflect.DeepEqual(record, want) || account != "Expenses:Groceries" {
+		t.Errorf("got %v and %v, want %v and %v", record, account, want, "Expenses:Groceries")
+	}
+}
+
+func TestGetRuleList(t *testing.T) {
+	var tests = []struct {
+		name  string
+		value interface{}
+		want  []string
+	}{
+		{"test #1 list", []interface{}{"#food", "review"}, []string{"food", "review"}},
+		{"test #2 string", "food #review", []string{"food", "review"}},
+		{"test #3 missing", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ans := getRuleList(tt.value, "#")
+			if !reflect.DeepEqual(ans, tt.want) {
+				t.Errorf("got %v, want %v", ans, tt.want)
 			}
 		})
 	}
@@ -256,7 +546,7 @@ func TestApplyRuleSetting(t *testing.T) {
 	}
 }
 
-func TestParseCsvRecord(t *testing.T) {
+func TestRenderRecord(t *testing.T) {
 	var tests = []struct {
 		name  string
 		input []string
@@ -278,7 +568,7 @@ func TestParseCsvRecord(t *testing.T) {
 			`;; []string{"24.04.2019", "29.04.2019", "VISA RYANAIR", "Lastschrift", "NR8123456015 DUBLIN IE KAUFUMSATZ 18.04 223655 ARN74463669123456099978837", "6.823,05", "EUR", "-16,00", "EUR"}
 2019-04-24 * "VISA RYANAIR" "NR8123456015 DUBLIN IE KAUFUMSATZ 18.04 223655 ARN74463669123456099978837"
   Assets:Unknown  -16.00 EUR
-  Expenses:Unknown   16.00 EUR
+  Expenses:Unknown  16.00 EUR
 
 `,
 		},
@@ -298,7 +588,7 @@ func TestParseCsvRecord(t *testing.T) {
 			`;; []string{"26.04.2019", "26.04.2019", "Acme Corp GmbH", "Gehalt/Rente", "LOHN / GEHALT 04/19", "12.604,42", "EUR", "3.784,22", "EUR"}
 2019-04-26 * "Acme Corp GmbH" "LOHN / GEHALT 04/19"
   Expenses:Unknown  -3784.22 EUR
-  Assets:Unknown   3784.22 EUR
+  Assets:Unknown  3784.22 EUR
 
 `,
 		},
@@ -307,7 +597,7 @@ func TestParseCsvRecord(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			buf := new(bytes.Buffer)
-			parseCsvRecord(tt.input, DefaultConfigExample1, RecordTemplate, buf)
+			renderRecord(formatRecord(tt.input, DefaultConfigExample1), RecordTemplate, buf)
 			if buf.String() != tt.want {
 				t.Errorf("got %v, want %v", buf.String(), tt.want)
 			}
@@ -328,7 +618,7 @@ func TestCheckRule(t *testing.T) {
 	for _, tt := range tests {
 		testname := fmt.Sprintf("exp: '%s', str: '%s', want: '%v'", tt.exp, tt.str, tt.want)
 		t.Run(testname, func(t *testing.T) {
-			ans := checkRule(tt.exp, tt.str)
+			_, ans := checkRule(tt.exp, tt.str)
 			if ans != tt.want {
 				t.Errorf("got %v, want %v", ans, tt.want)
 			}
@@ -336,23 +626,169 @@ func TestCheckRule(t *testing.T) {
 	}
 }
 
-func TestFormatAmount(t *testing.T) {
+func TestRuleMatchExpand(t *testing.T) {
 	var tests = []struct {
-		input string
-		want  string
+		exp     string
+		str     string
+		setting string
+		want    string
 	}{
-		{"6,09", "6.09"},
-		{"20,82", "20.82"},
-		{"100,27", "100.27"},
-		{"1.344,01", "1344.01"},
+		{`LOHN / GEHALT (\d{2}/\d{2})`, "LOHN / GEHALT 04/19", "Salary ${1}", "Salary 04/19"},
+		{`LOHN / GEHALT (?P<month>\d{2})/(?P<year>\d{2})`, "LOHN / GEHALT 04/19", "Salary 20${year}-${month}", "Salary 2019-04"},
+		{`^VISA (\w+)`, "VISA RYANAIR", "Expenses:Travel:$1", "Expenses:Travel:RYANAIR"},
+		{`^VISA (\w+)`, "VISA RYANAIR", "Costs $$5", "Costs $5"},
+		{`^VISA`, "VISA RYANAIR", "no substitutions", "no substitutions"},
 	}
 
 	for _, tt := range tests {
-		testname := fmt.Sprintf("input: '%s', want: '%s'", tt.input, tt.want)
+		testname := fmt.Sprintf("exp: '%s', setting: '%s'", tt.exp, tt.setting)
 		t.Run(testname, func(t *testing.T) {
-			ans := formatAmount(tt.input)
-			if ans != tt.want {
-				t.Errorf("got '%s', want '%s'", ans, tt.want)
+			match, ok := checkRule(tt.exp, tt.str)
+			if !ok {
+				t.Fatalf("expected a match")
+			}
+
+			if ans := match.expand(tt.setting); ans != tt.want {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRecordAmountOut(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input []string
+		want  []Posting
+	}{
+		{
+			"test #1 amount in",
+			[]string{"24.04.2019", "Acme Corp GmbH", "1.344,01", ""},
+			[]Posting{
+				{Account: "Expenses:Unknown", Amount: mustDecimalPtr("-1344.01"), Commodity: "EUR"},
+				{Account: "Assets:Unknown", Amount: mustDecimalPtr("1344.01"), Commodity: "EUR"},
+			},
+		},
+		{
+			"test #2 amount out",
+			[]string{"24.04.2019", "VISA RYANAIR", "", "16,00"},
+			[]Posting{
+				{Account: "Assets:Unknown", Amount: mustDecimalPtr("-16.00"), Commodity: "EUR"},
+				{Account: "Expenses:Unknown", Amount: mustDecimalPtr("16.00"), Commodity: "EUR"},
+			},
+		},
+		{
+			"test #3 signed amount out",
+			[]string{"24.04.2019", "VISA RYANAIR", "", "-16,00"},
+			[]Posting{
+				{Account: "Assets:Unknown", Amount: mustDecimalPtr("-16.00"), Commodity: "EUR"},
+				{Account: "Expenses:Unknown", Amount: mustDecimalPtr("16.00"), Commodity: "EUR"},
+			},
+		},
+	}
+
+	config := DefaultConfigExample1
+	config.Csv.AmountIn = Column{Index: 2}
+	config.Csv.AmountOut = Column{Index: 3}
+	config.Csv.Description = Column{Index: 1}
+	config.Csv.Payee = Column{Index: 1}
+	config.TransactionsRules = nil
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := formatRecord(tt.input, config)
+			if !reflect.DeepEqual(record.Postings, tt.want) {
+				t.Errorf("got %v, want %v", record.Postings, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRecordIndicator(t *testing.T) {
+	config := DefaultConfigExample1
+	config.Csv.AmountIn = Column{Index: 2}
+	config.Csv.AmountOut = Column{Index: 2}
+	config.Csv.Description = Column{Index: 1}
+	config.Csv.Indicator = &Column{Index: 3}
+	config.Csv.Payee = Column{Index: 1}
+	config.TransactionsRules = nil
+
+	var tests = []struct {
+		name  string
+		input []string
+		want  []Posting
+	}{
+		{
+			"test #1 soll",
+			[]string{"24.04.2019", "VISA RYANAIR", "16,00", "S"},
+			[]Posting{
+				{Account: "Assets:Unknown", Amount: mustDecimalPtr("-16.00"), Commodity: "EUR"},
+				{Account: "Expenses:Unknown", Amount: mustDecimalPtr("16.00"), Commodity: "EUR"},
+			},
+		},
+		{
+			"test #2 haben",
+			[]string{"26.04.2019", "Acme Corp GmbH", "3.784,22", "H"},
+			[]Posting{
+				{Account: "Expenses:Unknown", Amount: mustDecimalPtr("-3784.22"), Commodity: "EUR"},
+				{Account: "Assets:Unknown", Amount: mustDecimalPtr("3784.22"), Commodity: "EUR"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := formatRecord(tt.input, config)
+			if !reflect.DeepEqual(record.Postings, tt.want) {
+				t.Errorf("got %v, want %v", record.Postings, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRecordCurrency(t *testing.T) {
+	config := DefaultConfigExample1
+	config.Csv.CurrencyColumn = &Column{Index: 8}
+	config.Csv.OriginalAmount = &Column{Index: 9}
+	config.Csv.OriginalCurrency = &Column{Index: 10}
+	config.TransactionsRules = nil
+
+	var tests = []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{
+			"test #1 currency column",
+			[]string{"24.04.2019", "29.04.2019", "VISA RYANAIR", "Lastschrift", "NR8123456015", "6.823,05", "USD", "-16,00", "USD", "", ""},
+			[]string{"Assets:Unknown  -16.00 USD", "Expenses:Unknown  16.00 USD"},
+		},
+		{
+			"test #2 foreign card spend",
+			[]string{"24.04.2019", "29.04.2019", "VISA PRET A MANGER", "Lastschrift", "NR8123456015", "6.823,05", "EUR", "-16,00", "EUR", "14,20", "GBP"},
+			[]string{"Assets:Unknown  -16.00 EUR @@ 14.20 GBP", "Expenses:Unknown  14.20 GBP"},
+		},
+		{
+			"test #3 foreign refund",
+			[]string{"24.04.2019", "29.04.2019", "VISA PRET A MANGER", "Gutschrift", "NR8123456015", "6.823,05", "EUR", "16,00", "EUR", "-14,20", "GBP"},
+			[]string{"Expenses:Unknown  -14.20 GBP", "Assets:Unknown  16.00 EUR @@ 14.20 GBP"},
+		},
+		{
+			"test #4 same currency",
+			[]string{"24.04.2019", "29.04.2019", "VISA RYANAIR", "Lastschrift", "NR8123456015", "6.823,05", "EUR", "-16,00", "EUR", "16,00", "EUR"},
+			[]string{"Assets:Unknown  -16.00 EUR", "Expenses:Unknown  16.00 EUR"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ans []string
+			for _, posting := range formatRecord(tt.input, config).Postings {
+				ans = append(ans, posting.String())
+			}
+
+			if !reflect.DeepEqual(ans, tt.want) {
+				t.Errorf("got %v, want %v", ans, tt.want)
 			}
 		})
 	}
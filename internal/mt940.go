@@ -0,0 +1,343 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// mt940Header names the fields of the rows of mt940 statements
+var mt940Header = []string{"Date", "ValueDate", "Amount", "Mark", "TransactionType", "Reference", "BankReference", "Details", "Code", "PostingText", "Purpose", "BIC", "IBAN", "Name", "Information"}
+
+// mt940Columns are the fields of mt940 statements the records are taken from
+var mt940Columns = statementColumns{
+	amount:      "Amount",
+	date:        "Date",
+	description: "Purpose",
+	payee:       "Name",
+}
+
+var (
+	// mt940Tag matches the line starting a field, e.g. :61:
+	mt940Tag = regexp.MustCompile(`^:(\d{2}[A-Z]?):`)
+	// mt940Balance matches the value of a balance field, e.g. C200401EUR1234,56
+	mt940Balance = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})([\d,]+)$`)
+	// mt940Line matches the value of a statement line, i.e. the value date, the
+	// entry date, the credit/debit mark, the funds code, the amount, the
+	// transaction type, the references and the supplementary details
+	mt940Line = regexp.MustCompile(`^(\d{6})(\d{4})?(R?[CD])([A-Z])?([\d,]+)([NFS][A-Z0-9]{3})([^\n]*?)(?://([^\n]*))?(?:\n(.*))?$`)
+	// mt940Subfield matches a structured information subfield, e.g. ?20
+	mt940Subfield = regexp.MustCompile(`\?(\d{2})`)
+	// mt940Keyword matches a keyword of swift structured information, e.g. /NAME/
+	mt940Keyword = regexp.MustCompile(`/(ADDR|BENM|BIC|CSID|EREF|IBAN|INFO|IREF|MARF|NAME|ORDP|PREF|REMI|RTRN|SVCL|TRTP|ULTB|ULTD)/`)
+)
+
+// mt940Field is a field of an mt940 message, its continuation lines
+// included
+type mt940Field struct {
+	tag   string // The tag, e.g. 61
+	value string // The value, lines joined by line breaks
+}
+
+// ProcessMt940File ...
+func ProcessMt940File(file io.Reader, config Config, template string) {
+	processMt940File(file, config, template, os.Stdout)
+}
+
+// processMt940File converts every statement of an mt940 or mt942 file, the
+// transactions of each being converted like the rows of a csv file
+func processMt940File(file io.Reader, config Config, template string, output io.Writer) {
+	statements, err := parseMt940(file)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("error reading mt940 file")
+	}
+
+	for _, s := range statements {
+		processStatement(s, config, template, output)
+	}
+}
+
+// parseMt940 reads the statements of an mt940 or mt942 file, each message
+// starting with a :20: field
+func parseMt940(file io.Reader) ([]statement, error) {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := decodeStatement(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages [][]mt940Field
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		// trailing spaces are kept, as a value can be wrapped after one
+		switch trimmed := strings.TrimSpace(line); {
+		case trimmed == "", trimmed == "-", strings.HasPrefix(trimmed, "-}"), strings.HasPrefix(trimmed, "{"):
+			// the end of a message, or the swift blocks around it
+		case mt940Tag.MatchString(line):
+			match := mt940Tag.FindStringSubmatch(line)
+			field := mt940Field{tag: match[1], value: line[len(match[0]):]}
+
+			if field.tag == "20" || len(messages) == 0 {
+				messages = append(messages, nil)
+			}
+
+			messages[len(messages)-1] = append(messages[len(messages)-1], field)
+		case len(messages) > 0:
+			message := messages[len(messages)-1]
+			message[len(message)-1].value += "\n" + line
+		}
+	}
+
+	var statements []statement
+
+	for _, message := range messages {
+		s, err := mt940Statement(message)
+		if err != nil {
+			return nil, err
+		}
+
+		statements = append(statements, s)
+	}
+
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("no mt940 statement found")
+	}
+
+	return statements, nil
+}
+
+// mt940Statement reads a message, its :61: statement lines followed by the
+// :86: information of each, and its opening and closing balances
+func mt940Statement(message []mt940Field) (statement, error) {
+	s := statement{
+		columns: mt940Columns,
+		header:  mt940Header,
+		info:    map[string]string{},
+	}
+
+	var lines []map[string]string
+
+	for _, field := range message {
+		switch field.tag {
+		case "20":
+			s.info["reference"] = field.value
+		case "25":
+			s.info["account"] = field.value
+		case "28", "28C":
+			s.info["number"] = field.value
+		case "60F", "60M", "62F", "62M":
+			balance, err := parseMt940Balance(field.value)
+			if err != nil {
+				return s, fmt.Errorf(":%s: %v", field.tag, err)
+			}
+
+			// an opening balance carries over the previous statement's
+			// closing balance and its date, so it's the balance at the
+			// start of the day after, while the intermediate balances of
+			// a day split across messages can't be asserted at all
+			balance.closing = strings.HasPrefix(field.tag, "62")
+			if !balance.closing {
+				balance.time = balance.time.AddDate(0, 0, 1)
+			}
+
+			if strings.HasSuffix(field.tag, "F") {
+				s.balances = append(s.balances, balance)
+			}
+
+			if s.currency == "" {
+				s.currency = balance.currency
+				s.info["currency"] = balance.currency
+			}
+		case "61":
+			line, err := parseMt940Line(field.value)
+			if err != nil {
+				return s, fmt.Errorf(":61:%s: %v", field.value, err)
+			}
+
+			lines = append(lines, line)
+		case "86":
+			if len(lines) > 0 {
+				addMt940Information(lines[len(lines)-1], field.value)
+			}
+		}
+	}
+
+	for _, line := range lines {
+		row := make([]string, len(mt940Header))
+		for i, name := range mt940Header {
+			row[i] = line[name]
+		}
+
+		s.rows = append(s.rows, row)
+	}
+
+	return s, nil
+}
+
+// parseMt940Balance parses the value of a balance field
+func parseMt940Balance(value string) (statementBalance, error) {
+	match := mt940Balance.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return statementBalance{}, fmt.Errorf("invalid balance %q", value)
+	}
+
+	t, err := time.Parse("060102", match[2])
+	if err != nil {
+		return statementBalance{}, fmt.Errorf("invalid date %q", match[2])
+	}
+
+	amount, err := parseMt940Amount(match[4])
+	if err != nil {
+		return statementBalance{}, err
+	}
+
+	if match[1] == "D" {
+		amount = amount.Neg()
+	}
+
+	return statementBalance{amount: amount, currency: match[3], time: t}, nil
+}
+
+// parseMt940Line reads the mt940Header fields of a :61: statement line, its
+// date being the entry date if it has one and the value date otherwise
+func parseMt940Line(value string) (map[string]string, error) {
+	match := mt940Line.FindStringSubmatch(value)
+	if match == nil {
+		return nil, fmt.Errorf("invalid statement line")
+	}
+
+	valueDate, err := time.Parse("060102", match[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid value date %q", match[1])
+	}
+
+	date := valueDate
+
+	// the entry date has no year, which is the value date's year unless
+	// the two are either side of the turn of the year
+	if match[2] != "" {
+		entry, err := time.Parse("0102", match[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry date %q", match[2])
+		}
+
+		year := valueDate.Year()
+		switch {
+		case entry.Month() == time.December && valueDate.Month() == time.January:
+			year--
+		case entry.Month() == time.January && valueDate.Month() == time.December:
+			year++
+		}
+
+		date = time.Date(year, entry.Month(), entry.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	amount, err := parseMt940Amount(match[5])
+	if err != nil {
+		return nil, err
+	}
+
+	// debits and reversed credits take money out of the account
+	if match[3] == "D" || match[3] == "RC" {
+		amount = amount.Neg()
+	}
+
+	return map[string]string{
+		"Amount":          amount.String(),
+		"BankReference":   strings.TrimSpace(match[8]),
+		"Date":            date.Format(StatementDateLayout),
+		"Details":         strings.TrimSpace(match[9]),
+		"Mark":            match[3],
+		"Reference":       strings.TrimSpace(match[7]),
+		"TransactionType": match[6],
+		"ValueDate":       valueDate.Format(StatementDateLayout),
+	}, nil
+}
+
+// parseMt940Amount parses an amount, which always has a decimal comma
+func parseMt940Amount(value string) (Decimal, error) {
+	return ParseDecimal(strings.Replace(value, ",", ".", 1))
+}
+
+// addMt940Information adds the fields of the :86: information to those of
+// its statement line. The German structured form is a transaction code
+// followed by ?nn subfields, ?00 being the posting text, ?20 to ?29 and ?60
+// to ?63 the purpose, ?30 the BIC, ?31 the IBAN and ?32 and ?33 the
+// counterparty. The swift structured form has /NAME/, /REMI/, /IBAN/ and
+// /BIC/ keywords, and anything else is taken to be the purpose as it is.
+func addMt940Information(fields map[string]string, value string) {
+	information := strings.ReplaceAll(value, "\n", "")
+	fields["Information"] = information
+
+	switch {
+	case len(information) > 3 && strings.HasPrefix(information[3:], "?"):
+		fields["Code"] = information[:3]
+
+		var purpose, name []string
+
+		subfields := mt940Subfield.FindAllStringSubmatchIndex(information, -1)
+		for i, subfield := range subfields {
+			end := len(information)
+			if i+1 < len(subfields) {
+				end = subfields[i+1][0]
+			}
+
+			content := information[subfield[1]:end]
+
+			switch code := information[subfield[2]:subfield[3]]; {
+			case code == "00":
+				fields["PostingText"] = strings.TrimSpace(content)
+			case code >= "20" && code <= "29", code >= "60" && code <= "63":
+				purpose = append(purpose, content)
+			case code == "30":
+				fields["BIC"] = strings.TrimSpace(content)
+			case code == "31":
+				fields["IBAN"] = strings.TrimSpace(content)
+			case code == "32", code == "33":
+				name = append(name, content)
+			}
+		}
+
+		fields["Purpose"] = strings.TrimSpace(strings.Join(purpose, ""))
+		fields["Name"] = strings.TrimSpace(strings.Join(name, ""))
+	case strings.HasPrefix(information, "/") && mt940Keyword.MatchString(information):
+		keywords := mt940Keyword.FindAllStringSubmatchIndex(information, -1)
+		for i, keyword := range keywords {
+			end := len(information)
+			if i+1 < len(keywords) {
+				end = keywords[i+1][0]
+			}
+
+			content := strings.TrimSpace(information[keyword[1]:end])
+
+			switch information[keyword[2]:keyword[3]] {
+			case "BIC":
+				fields["BIC"] = content
+			case "IBAN":
+				fields["IBAN"] = content
+			case "NAME":
+				fields["Name"] = content
+			case "REMI":
+				fields["Purpose"] = content
+			case "TRTP":
+				fields["PostingText"] = content
+			}
+		}
+	default:
+		fields["Purpose"] = strings.Join(strings.Fields(value), " ")
+	}
+}
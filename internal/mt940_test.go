@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var mt940File = `{1:F01MARKDEF1AXXX0000000000}{2:I940MARKDEF1XXXXN}{4:
+:20:STARTUMS
+:25:10020030/1234567
+:28C:00001/001
+:60F:C200331EUR1000,00
+:61:2004010401DR52,49NDDTNONREF//2020040112345
+:86:105?00LASTSCHRIFT?109310?20EREF+INV-2020-17?21MREF+M-123?22SVWZ+Abschl
+ag Strom April?232020?30COBADEFFXXX?31DE02120300000000202051?32Stadtwerke 
+Musterstadt
+:61:2004020402CR2400,NTRFNONREF
+:86:166?00GUTSCHRIFT?20LOHN / GEHALT 03/2020?32Acme Corp GmbH
+:61:2004020402RC10,00NMSC
+:86:Storno Gutschrift
+:62F:C200402EUR3337,51
+-}
+`
+
+var mt940SwiftFile = `:20:940S200430
+:25:NL91ABNA0417164300
+:28C:120/1
+:60M:D200430EUR10,00
+:61:200430D25,00NTRFEREF//00074901
+/TRCD/00100/
+:86:/TRTP/SEPA OVERBOEKING/IBAN/NL20INGB0001234567/BIC/INGBNL2A/NAME/
+Fitness Club/REMI/Membership April/EREF/NOTPROVIDED
+:62M:D200430EUR35,00
+-
+`
+
+func TestParseMt940(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		info     map[string]string
+		rows     [][]string
+		balances []statementBalance
+	}{
+		{
+			"german",
+			mt940File,
+			map[string]string{"account": "10020030/1234567", "currency": "EUR", "number": "00001/001", "reference": "STARTUMS"},
+			[][]string{
+				{"2020-04-01", "2020-04-01", "-52.49", "D", "NDDT", "NONREF", "2020040112345", "", "105", "LASTSCHRIFT", "EREF+INV-2020-17MREF+M-123SVWZ+Abschlag Strom April2020", "COBADEFFXXX", "DE02120300000000202051", "Stadtwerke Musterstadt",
+					"105?00LASTSCHRIFT?109310?20EREF+INV-2020-17?21MREF+M-123?22SVWZ+Abschlag Strom April?232020?30COBADEFFXXX?31DE02120300000000202051?32Stadtwerke Musterstadt"},
+				{"2020-04-02", "2020-04-02", "2400", "C", "NTRF", "NONREF", "", "", "166", "GUTSCHRIFT", "LOHN / GEHALT 03/2020", "", "", "Acme Corp GmbH", "166?00GUTSCHRIFT?20LOHN / GEHALT 03/2020?32Acme Corp GmbH"},
+				{"2020-04-02", "2020-04-02", "-10.00", "RC", "NMSC", "", "", "", "", "", "Storno Gutschrift", "", "", "", "Storno Gutschrift"},
+			},
+			[]statementBalance{
+				{amount: mustDecimal("1000.00"), currency: "EUR", time: mustDate("2020-04-01")},
+				{amount: mustDecimal("3337.51"), closing: true, currency: "EUR", time: mustDate("2020-04-02")},
+			},
+		},
+		{
+			"swift",
+			mt940SwiftFile,
+			map[string]string{"account": "NL91ABNA0417164300", "currency": "EUR", "number": "120/1", "reference": "940S200430"},
+			[][]string{
+				{"2020-04-30", "2020-04-30", "-25.00", "D", "NTRF", "EREF", "00074901", "/TRCD/00100/", "", "SEPA OVERBOEKING", "Membership April", "INGBNL2A", "NL20INGB0001234567", "Fitness Club",
+					"/TRTP/SEPA OVERBOEKING/IBAN/NL20INGB0001234567/BIC/INGBNL2A/NAME/Fitness Club/REMI/Membership April/EREF/NOTPROVIDED"},
+			},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements, err := parseMt940(strings.NewReader(tt.file))
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			if len(statements) != 1 {
+				t.Fatalf("got %d statements, want 1", len(statements))
+			}
+
+			s := statements[0]
+
+			if !reflect.DeepEqual(s.info, tt.info) {
+				t.Errorf("got info %v, want %v", s.info, tt.info)
+			}
+
+			if !reflect.DeepEqual(s.rows, tt.rows) {
+				t.Errorf("got rows %q, want %q", s.rows, tt.rows)
+			}
+
+			if !reflect.DeepEqual(s.balances, tt.balances) {
+				t.Errorf("got balances %v, want %v", s.balances, tt.balances)
+			}
+		})
+	}
+}
+
+func TestParseMt940Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"empty", "\n"},
+		{"invalid balance", strings.Replace(mt940File, "C200331EUR1000,00", "C200331EUR", 1)},
+		{"invalid line", strings.Replace(mt940File, "2004020402CR2400,", "2004020402X2400,", 1)},
+		{"invalid date", strings.Replace(mt940File, ":61:2004010401", ":61:2004310401", 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseMt940(strings.NewReader(tt.file)); err == nil {
+				t.Errorf("got no error")
+			}
+		})
+	}
+}
+
+func TestProcessMt940File(t *testing.T) {
+	config := DefaultConfigExample1
+	config.Csv.ProcessingAccount = "Assets:Girokonto"
+	config.TransactionsRules = TransactionsRulesConfig{
+		TransactionRule{Name: "salary", SetAccount: "Income:Salary", MatchPayee: "Acme Corp"},
+		TransactionRule{Name: "power", SetAccount: "Expenses:Utilities", MatchDescription: "Abschlag Strom"},
+	}
+
+	want := `2020-04-01 "Stadtwerke Musterstadt" "EREF+INV-2020-17MREF+M-123SVWZ+Abschlag Strom April2020"
+  Assets:Girokonto  -52.49 EUR
+  Expenses:Utilities  52.49 EUR
+2020-04-02 "Acme Corp GmbH" "LOHN / GEHALT 03/2020"
+  Income:Salary  -2400 EUR
+  Assets:Girokonto  2400 EUR
+2020-04-02 "" "Storno Gutschrift"
+  Assets:Girokonto  -10.00 EUR
+  Expenses:Unknown  10.00 EUR
+2020-04-03 balance Assets:Girokonto  3337.51 EUR
+
+`
+
+	// the opening balance is the closing balance of its date, so it's
+	// asserted the day after, not on the date of the first entry
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{"opening balance the day before", mt940File, "2020-04-01 balance Assets:Girokonto  1000.00 EUR\n\n" + want},
+		{"opening balance on a friday", strings.Replace(mt940File, ":60F:C200331", ":60F:C200327", 1), "2020-03-28 balance Assets:Girokonto  1000.00 EUR\n\n" + want},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			processMt940File(strings.NewReader(tt.file), config, "{{.Date}} {{printf \"%q\" .Payee}} {{printf \"%q\" .Narration}}{{range .Postings}}\n  {{.}}{{end}}\n", buf)
+
+			if buf.String() != tt.want {
+				t.Errorf("got %v, want %v", buf.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The namespaces of the elements and attributes of ods content
+const (
+	odsOffice = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	odsTable  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	odsText   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+// ProcessOdsFile ...
+func ProcessOdsFile(file io.Reader, config Config, template string) {
+	processOdsFile(file, config, template, os.Stdout)
+}
+
+// processOdsFile converts the configured sheet of an ods file like a csv
+// file
+func processOdsFile(file io.Reader, config Config, template string, output io.Writer) {
+	config.Csv = spreadsheetConfig(config.Csv)
+
+	book, err := readOds(file, config.Csv)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("error reading ods file")
+	}
+
+	processSpreadsheet(book, config, template, output)
+}
+
+// readOds reads the sheets of an ods file. Numbers and dates are taken from
+// the values of the cells rather than from how they're displayed, dates
+// being written in the date layout. Repeated rows and cells are written out,
+// except for the empty ones padding the sheet.
+func readOds(file io.Reader, config CsvConfig) (spreadsheet, error) {
+	var book spreadsheet
+
+	archive, err := openZip(file)
+	if err != nil {
+		return book, err
+	}
+
+	data, err := readZipFile(archive, "content.xml")
+	if err != nil {
+		return book, err
+	}
+
+	if data == nil {
+		return book, fmt.Errorf("no content.xml found")
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return book, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Space != odsTable || start.Name.Local != "table" {
+			continue
+		}
+
+		name := odsAttr(start, odsTable, "name")
+
+		rows, err := readOdsTable(decoder, config)
+		if err != nil {
+			return book, fmt.Errorf("sheet %q: %v", name, err)
+		}
+
+		book.names = append(book.names, name)
+		book.sheets = append(book.sheets, rows)
+	}
+
+	return book, nil
+}
+
+// readOdsTable reads the rows of a table, up to its end element, rows
+// being found within row groups and header rows as well
+func readOdsTable(decoder *xml.Decoder, config CsvConfig) ([][]string, error) {
+	var rows [][]string
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.EndElement:
+			if t.Name.Space == odsTable && t.Name.Local == "table" {
+				return rows, nil
+			}
+		case xml.StartElement:
+			if t.Name.Space != odsTable || t.Name.Local != "table-row" {
+				continue
+			}
+
+			row, err := readOdsRow(decoder, config)
+			if err != nil {
+				return nil, err
+			}
+
+			// empty rows are left out like blank lines, however often
+			// they're repeated
+			if row = sheetRow(row); row == nil {
+				continue
+			}
+
+			for n := odsRepeat(t, "number-rows-repeated"); n > 0; n-- {
+				rows = append(rows, row)
+			}
+		}
+	}
+}
+
+// readOdsRow reads the cells of a row, up to its end element
+func readOdsRow(decoder *xml.Decoder, config CsvConfig) ([]string, error) {
+	var row []string
+
+	// the empty cells not written yet, which are only written once a
+	// cell with a value follows them
+	empty := 0
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.EndElement:
+			if t.Name.Space == odsTable && t.Name.Local == "table-row" {
+				return row, nil
+			}
+		case xml.StartElement:
+			if t.Name.Space != odsTable || (t.Name.Local != "table-cell" && t.Name.Local != "covered-table-cell") {
+				if err := decoder.Skip(); err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			value, err := readOdsCell(decoder, t, config)
+			if err != nil {
+				return nil, err
+			}
+
+			repeat := odsRepeat(t, "number-columns-repeated")
+
+			if value == "" {
+				empty += repeat
+				continue
+			}
+
+			for ; empty > 0; empty-- {
+				row = append(row, "")
+			}
+
+			for ; repeat > 0; repeat-- {
+				row = append(row, value)
+			}
+		}
+	}
+}
+
+// readOdsCell reads the value of a cell up to its end element, numbers and
+// dates being taken from its value attributes and everything else from its
+// paragraphs, which are joined by line breaks
+func readOdsCell(decoder *xml.Decoder, cell xml.StartElement, config CsvConfig) (string, error) {
+	var paragraphs []string
+	var text strings.Builder
+
+	depth := 0
+
+	for depth >= 0 {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == odsOffice && t.Name.Local == "annotation":
+				// comments aren't part of the value
+				if err := decoder.Skip(); err != nil {
+					return "", err
+				}
+
+				continue
+			case t.Name.Space == odsText && t.Name.Local == "p":
+				text.Reset()
+			case t.Name.Space == odsText && t.Name.Local == "s":
+				text.WriteString(strings.Repeat(" ", odsRepeat(t, "c")))
+			case t.Name.Space == odsText && t.Name.Local == "tab":
+				text.WriteString("\t")
+			case t.Name.Space == odsText && t.Name.Local == "line-break":
+				text.WriteString("\n")
+			}
+
+			depth++
+		case xml.EndElement:
+			if t.Name.Space == odsText && t.Name.Local == "p" {
+				paragraphs = append(paragraphs, text.String())
+			}
+
+			depth--
+		case xml.CharData:
+			text.Write(t)
+		}
+	}
+
+	switch odsAttr(cell, odsOffice, "value-type") {
+	case "float", "percentage", "currency":
+		return formatSheetNumber(odsAttr(cell, odsOffice, "value"), config)
+	case "date":
+		value := odsAttr(cell, odsOffice, "date-value")
+
+		t, err := parseOdsDate(value)
+		if err != nil {
+			return "", err
+		}
+
+		return formatSheetDate(t, config), nil
+	case "boolean":
+		if odsAttr(cell, odsOffice, "boolean-value") == "true" {
+			return "TRUE", nil
+		}
+
+		return "FALSE", nil
+	}
+
+	return strings.Join(paragraphs, "\n"), nil
+}
+
+// odsAttr returns the value of an attribute of an element, or an empty
+// string if it doesn't have it
+func odsAttr(element xml.StartElement, space, local string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Space == space && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+// odsRepeat returns the number of times an element is repeated, or of
+// spaces a text:s element stands for, 1 unless the attribute says otherwise
+func odsRepeat(element xml.StartElement, local string) int {
+	space := odsTable
+	if element.Name.Space == odsText {
+		space = odsText
+	}
+
+	n, err := strconv.Atoi(odsAttr(element, space, local))
+	if err != nil || n < 1 {
+		return 1
+	}
+
+	return n
+}
+
+// parseOdsDate parses the value of a date cell, a date optionally followed
+// by a time
+func parseOdsDate(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// odsContent is the content of an ods file with an info sheet and a sheet
+// of transactions, padded with repeated empty rows and cells the way office
+// suites save them
+var odsContent = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" xmlns:calcext="urn:org:documentfoundation:names:experimental:calc:xmlns:calcext:1.0" office:version="1.2">
+<office:body>
+<office:spreadsheet>
+<table:table table:name="Info">
+<table:table-row>
+<table:table-cell office:value-type="string" calcext:value-type="string"><text:p>Export</text:p></table:table-cell>
+<table:table-cell office:value-type="boolean" office:boolean-value="true" calcext:value-type="boolean"><text:p>WAHR</text:p></table:table-cell>
+</table:table-row>
+</table:table>
+<table:table table:name="Umsätze">
+<table:table-column table:number-columns-repeated="4"/>
+<table:table-row>
+<table:table-cell office:value-type="string"><text:p>Konto</text:p></table:table-cell>
+<table:table-cell office:value-type="float" office:value="1234567890"><text:p>1234567890</text:p></table:table-cell>
+<table:table-cell table:number-columns-repeated="1022"/>
+</table:table-row>
+<table:table-row table:number-rows-repeated="2">
+<table:table-cell table:number-columns-repeated="1024"/>
+</table:table-row>
+<table:table-header-rows>
+<table:table-row>
+<table:table-cell office:value-type="string"><text:p>Buchung</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>Auftraggeber/Empfänger</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>Verwendungszweck</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>Betrag</text:p></table:table-cell>
+</table:table-row>
+</table:table-header-rows>
+<table:table-row>
+<table:table-cell office:value-type="date" office:date-value="2019-04-26"><text:p>26.04.19</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>Acme Corp <text:span>GmbH</text:span></text:p><office:annotation><text:p>checked</text:p></office:annotation></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>LOHN /<text:s/>GEHALT<text:s text:c="2"/>04/19</text:p></table:table-cell>
+<table:table-cell office:value-type="currency" office:currency="EUR" office:value="3784.22"><text:p>3.784,22 €</text:p></table:table-cell>
+</table:table-row>
+<table:table-row>
+<table:table-cell office:value-type="date" office:date-value="2019-04-24T12:00:00"><text:p>24.04.19</text:p></table:table-cell>
+<table:table-cell office:value-type="string"><text:p>VISA RYANAIR</text:p><text:p>DUBLIN</text:p></table:table-cell>
+<table:table-cell/>
+<table:table-cell office:value-type="currency" office:currency="EUR" office:value="-16"><text:p>-16,00 €</text:p></table:table-cell>
+</table:table-row>
+<table:table-row>
+<table:table-cell table:number-columns-repeated="2" office:value-type="string"><text:p>Summe</text:p></table:table-cell>
+<table:table-cell table:number-columns-repeated="2"/>
+</table:table-row>
+<table:table-row table:number-rows-repeated="1048570">
+<table:table-cell table:number-columns-repeated="1024"/>
+</table:table-row>
+</table:table>
+</office:spreadsheet>
+</office:body>
+</office:document-content>`
+
+func TestReadOds(t *testing.T) {
+	tests := []struct {
+		name   string
+		config CsvConfig
+		want   spreadsheet
+	}{
+		{
+			"iso dates",
+			CsvConfig{DateLayoutIn: StatementDateLayout},
+			spreadsheet{
+				names: []string{"Info", "Umsätze"},
+				sheets: [][][]string{
+					{{"Export", "TRUE"}},
+					{
+						{"Konto", "1234567890"},
+						{"Buchung", "Auftraggeber/Empfänger", "Verwendungszweck", "Betrag"},
+						{"2019-04-26", "Acme Corp GmbH", "LOHN / GEHALT  04/19", "3784.22"},
+						{"2019-04-24", "VISA RYANAIR\nDUBLIN", "", "-16"},
+						{"Summe", "Summe"},
+					},
+				},
+			},
+		},
+		{
+			"german dates and trailing minus",
+			CsvConfig{DateLayoutIn: "02.01.2006", DecimalSeparator: ",", NegativeStyle: NegativeTrailing},
+			spreadsheet{
+				names: []string{"Info", "Umsätze"},
+				sheets: [][][]string{
+					{{"Export", "TRUE"}},
+					{
+						{"Konto", "1234567890"},
+						{"Buchung", "Auftraggeber/Empfänger", "Verwendungszweck", "Betrag"},
+						{"26.04.2019", "Acme Corp GmbH", "LOHN / GEHALT  04/19", "3784,22"},
+						{"24.04.2019", "VISA RYANAIR\nDUBLIN", "", "16-"},
+						{"Summe", "Summe"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ans, err := readOds(zipFile(t, map[string]string{"content.xml": odsContent}), tt.config)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			if !reflect.DeepEqual(ans, tt.want) {
+				t.Errorf("got %q, want %q", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadOdsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"no content", map[string]string{"meta.xml": "<office:document-meta/>"}},
+		{"invalid number", map[string]string{"content.xml": `<table:table xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"><table:table-row><table:table-cell office:value-type="float" office:value="abc"/></table:table-row></table:table>`}},
+		{"invalid date", map[string]string{"content.xml": `<table:table xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"><table:table-row><table:table-cell office:value-type="date" office:date-value="26.04.2019"/></table:table-row></table:table>`}},
+		{"truncated", map[string]string{"content.xml": odsContent[:len(odsContent)/2]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readOds(zipFile(t, tt.files), CsvConfig{}); err == nil {
+				t.Errorf("got no error")
+			}
+		})
+	}
+}
+
+func TestProcessOdsFile(t *testing.T) {
+	config := DefaultConfigExample1
+	config.Csv.AmountIn = Column{Index: 3}
+	config.Csv.AmountOut = Column{Index: 3}
+	config.Csv.DateLayoutIn = ""
+	config.Csv.Payee = Column{Index: 1}
+	config.Csv.Description = Column{Index: 2}
+	config.Csv.ProcessingAccount = "Assets:Girokonto"
+	config.Csv.Sheet = "2"
+	config.Csv.Skip = 2
+	config.Csv.SkipFooter = 1
+
+	want := `2019-04-26 "Acme Corp GmbH" "LOHN / GEHALT  04/19"
+  Expenses:Unknown  -3784.22 EUR
+  Assets:Girokonto  3784.22 EUR
+2019-04-24 "VISA RYANAIR\nDUBLIN" ""
+  Assets:Girokonto  -16 EUR
+  Expenses:Unknown  16 EUR
+`
+
+	buf := new(bytes.Buffer)
+	processOdsFile(zipFile(t, map[string]string{"content.xml": odsContent}), config, "{{.Date}} {{printf \"%q\" .Payee}} {{printf \"%q\" .Narration}}{{range .Postings}}\n  {{.}}{{end}}\n", buf)
+
+	if buf.String() != want {
+		t.Errorf("got %v, want %v", buf.String(), want)
+	}
+}
@@ -0,0 +1,316 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ofxHeader names the fields of the rows of ofx statements, the names of
+// the elements of a STMTTRN they're taken from
+var ofxHeader = []string{"TRNTYPE", "DTPOSTED", "DTUSER", "TRNAMT", "FITID", "CHECKNUM", "REFNUM", "SIC", "NAME", "MEMO", "CURRENCY"}
+
+// ofxColumns are the fields of ofx statements the records are taken from
+var ofxColumns = statementColumns{
+	amount:      "TRNAMT",
+	currency:    "CURRENCY",
+	date:        "DTPOSTED",
+	description: "MEMO",
+	id:          "FITID",
+	meta:        "fitid",
+	payee:       "NAME",
+}
+
+// ofxElement is an element of an ofx document, either an aggregate holding
+// other elements or a leaf holding a value
+type ofxElement struct {
+	children []*ofxElement // The elements of an aggregate
+	name     string        // The upper case element name
+	value    string        // The value of a leaf, unescaped
+}
+
+// ProcessOfxFile ...
+func ProcessOfxFile(file io.Reader, config Config, template string) {
+	processOfxFile(file, config, template, os.Stdout)
+}
+
+// processOfxFile converts every bank and credit card statement of an ofx or
+// qfx file, the transactions of each being converted like the rows of a
+// csv file
+func processOfxFile(file io.Reader, config Config, template string, output io.Writer) {
+	statements, err := parseOfx(file)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("error reading ofx file")
+	}
+
+	for _, s := range statements {
+		processStatement(s, config, template, output)
+	}
+}
+
+// parseOfx reads the statements of an ofx file, either ofx 1 which is sgml
+// with optional end tags and a header of its own, or ofx 2 which is xml
+func parseOfx(file io.Reader) ([]statement, error) {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// ofx 1 files are mostly in windows-1252 rather than utf-8
+	text, err := decodeStatement(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := parseOfxElements(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []statement
+
+	for _, name := range []string{"STMTRS", "CCSTMTRS"} {
+		for _, element := range root.all(name) {
+			s, err := ofxStatement(element)
+			if err != nil {
+				return nil, err
+			}
+
+			statements = append(statements, s)
+		}
+	}
+
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("no bank or credit card statement found")
+	}
+
+	return statements, nil
+}
+
+// parseOfxElements parses the elements of an ofx document. The end tags of
+// leaves are optional in sgml, so a leaf is ended by its value, and an end
+// tag ends the innermost element of its name that's still open.
+func parseOfxElements(data string) (*ofxElement, error) {
+	start := strings.Index(strings.ToUpper(data), "<OFX>")
+	if start < 0 {
+		return nil, fmt.Errorf("no <OFX> element found")
+	}
+
+	root := &ofxElement{}
+	stack := []*ofxElement{root}
+
+	for rest := data[start:]; rest != ""; {
+		open := strings.IndexByte(rest, '<')
+		if open < 0 {
+			open = len(rest)
+		}
+
+		if value := strings.TrimSpace(html.UnescapeString(rest[:open])); value != "" && len(stack) > 1 {
+			stack[len(stack)-1].value = value
+			stack = stack[:len(stack)-1]
+		}
+
+		if open == len(rest) {
+			break
+		}
+
+		end := strings.IndexByte(rest[open:], '>')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated tag %q", rest[open:])
+		}
+
+		tag := strings.TrimSpace(rest[open+1 : open+end])
+		rest = rest[open+end+1:]
+
+		switch {
+		case strings.HasPrefix(tag, "?"), strings.HasPrefix(tag, "!"):
+			// processing instructions and comments
+		case strings.HasPrefix(tag, "/"):
+			name := strings.ToUpper(strings.TrimSpace(tag[1:]))
+
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+		default:
+			element := &ofxElement{name: strings.ToUpper(strings.TrimSuffix(tag, "/"))}
+
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, element)
+
+			if !strings.HasSuffix(tag, "/") {
+				stack = append(stack, element)
+			}
+		}
+	}
+
+	return root, nil
+}
+
+// find returns the first element of the path, each element of it being
+// looked for among all the descendants of the one before, or nil
+func (e *ofxElement) find(path ...string) *ofxElement {
+	if len(path) == 0 {
+		return e
+	}
+
+	for _, child := range e.children {
+		if child.name == path[0] {
+			if found := child.find(path[1:]...); found != nil {
+				return found
+			}
+		}
+
+		if found := child.find(path...); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// get returns the value of the first element of the path, or an empty
+// string if there's no such element
+func (e *ofxElement) get(path ...string) string {
+	if found := e.find(path...); found != nil {
+		return found.value
+	}
+
+	return ""
+}
+
+// all returns the descendants of the given name, in document order
+func (e *ofxElement) all(name string) []*ofxElement {
+	var elements []*ofxElement
+
+	for _, child := range e.children {
+		if child.name == name {
+			elements = append(elements, child)
+			continue
+		}
+
+		elements = append(elements, child.all(name)...)
+	}
+
+	return elements
+}
+
+// ofxStatement reads a bank or credit card statement, its ledger balance
+// being the balance at the end of the day it's dated
+func ofxStatement(element *ofxElement) (statement, error) {
+	account := element.find("BANKACCTFROM")
+	if account == nil {
+		account = element.find("CCACCTFROM")
+	}
+
+	if account == nil {
+		account = &ofxElement{}
+	}
+
+	s := statement{
+		columns:  ofxColumns,
+		currency: element.get("CURDEF"),
+		header:   ofxHeader,
+		info: map[string]string{
+			"account":  account.get("ACCTID"),
+			"bank":     account.get("BANKID"),
+			"currency": element.get("CURDEF"),
+			"type":     account.get("ACCTTYPE"),
+		},
+	}
+
+	for _, transaction := range element.all("STMTTRN") {
+		row, err := ofxTransaction(transaction)
+		if err != nil {
+			return s, fmt.Errorf("transaction %q: %v", transaction.get("FITID"), err)
+		}
+
+		s.rows = append(s.rows, row)
+	}
+
+	if ledger := element.find("LEDGERBAL"); ledger != nil {
+		amount, err := parseOfxAmount(ledger.get("BALAMT"))
+		if err != nil {
+			return s, fmt.Errorf("ledger balance: %v", err)
+		}
+
+		t, err := parseOfxDate(ledger.get("DTASOF"))
+		if err != nil {
+			return s, fmt.Errorf("ledger balance: %v", err)
+		}
+
+		s.balances = append(s.balances, statementBalance{amount: amount, closing: true, time: t})
+	}
+
+	return s, nil
+}
+
+// ofxTransaction lays out a STMTTRN as a row of the ofxHeader fields, with
+// its dates and amount normalized
+func ofxTransaction(transaction *ofxElement) ([]string, error) {
+	row := make([]string, len(ofxHeader))
+
+	for i, name := range ofxHeader {
+		switch name {
+		case "CURRENCY":
+			row[i] = transaction.get("CURRENCY", "CURSYM")
+		case "DTPOSTED", "DTUSER":
+			if value := transaction.get(name); value != "" {
+				t, err := parseOfxDate(value)
+				if err != nil {
+					return nil, err
+				}
+
+				row[i] = t.Format(StatementDateLayout)
+			}
+		case "TRNAMT":
+			amount, err := parseOfxAmount(transaction.get(name))
+			if err != nil {
+				return nil, err
+			}
+
+			row[i] = amount.String()
+		default:
+			row[i] = transaction.get(name)
+		}
+	}
+
+	return row, nil
+}
+
+// parseOfxDate parses the day of an ofx date, which is followed by an
+// optional time and time zone, e.g. 20200131120000.000[-5:EST]
+func parseOfxDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if len(value) > 8 {
+		value = value[:8]
+	}
+
+	t, err := time.Parse("20060102", value)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %q", value)
+	}
+
+	return t, nil
+}
+
+// parseOfxAmount parses an ofx amount, which some banks write with a
+// decimal comma
+func parseOfxAmount(value string) (Decimal, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, ".") {
+		value = strings.Replace(value, ",", ".", 1)
+	}
+
+	return ParseDecimal(value)
+}
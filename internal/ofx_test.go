@@ -0,0 +1,264 @@
+package internal
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var ofxSgmlFile = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+SECURITY:NONE
+ENCODING:USASCII
+CHARSET:1252
+COMPRESSION:NONE
+OLDFILEUID:NONE
+NEWFILEUID:NONE
+
+<OFX>
+<SIGNONMSGSRSV1>
+<SONRS>
+<STATUS>
+<CODE>0
+<SEVERITY>INFO
+</STATUS>
+<DTSERVER>20200331120000
+<LANGUAGE>ENG
+</SONRS>
+</SIGNONMSGSRSV1>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<TRNUID>1
+<STATUS>
+<CODE>0
+<SEVERITY>INFO
+</STATUS>
+<STMTRS>
+<CURDEF>USD
+<BANKACCTFROM>
+<BANKID>121000248
+<ACCTID>1234567890
+<ACCTTYPE>CHECKING
+</BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>20200301
+<DTEND>20200331
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20200302120000.000[-5:EST]
+<TRNAMT>-42.50
+<FITID>202003020001
+<NAME>WHOLE FOODS MARKET
+<MEMO>
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CHECK
+<DTPOSTED>20200305
+<TRNAMT>-1200.00
+<FITID>202003050001
+<CHECKNUM>1001
+<NAME>J &amp; J PROPERTIES
+<MEMO>RENT MARCH
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20200315
+<TRNAMT>2500.00
+<FITID>202003150001
+<NAME>ACME CORP PAYROLL
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20200315
+<TRNAMT>2500.00
+<FITID>202003150001
+<NAME>ACME CORP PAYROLL
+</STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL>
+<BALAMT>3257.50
+<DTASOF>20200331
+</LEDGERBAL>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`
+
+var ofxXMLFile = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+  <CREDITCARDMSGSRSV1>
+    <CCSTMTTRNRS>
+      <TRNUID>1</TRNUID>
+      <CCSTMTRS>
+        <CURDEF>EUR</CURDEF>
+        <CCACCTFROM>
+          <ACCTID>4111111111111111</ACCTID>
+        </CCACCTFROM>
+        <BANKTRANLIST>
+          <DTSTART>20200401</DTSTART>
+          <DTEND>20200430</DTEND>
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>20200403</DTPOSTED>
+            <TRNAMT>-19,99</TRNAMT>
+            <FITID>A1</FITID>
+            <PAYEE>
+              <NAME>Café Müller</NAME>
+            </PAYEE>
+            <MEMO></MEMO>
+          </STMTTRN>
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>20200410</DTPOSTED>
+            <TRNAMT>-12.00</TRNAMT>
+            <FITID>A2</FITID>
+            <NAME>Amazon</NAME>
+            <CURRENCY>
+              <CURRATE>0.9</CURRATE>
+              <CURSYM>USD</CURSYM>
+            </CURRENCY>
+          </STMTTRN>
+        </BANKTRANLIST>
+        <LEDGERBAL>
+          <BALAMT>-31.99</BALAMT>
+          <DTASOF>20200430235959</DTASOF>
+        </LEDGERBAL>
+      </CCSTMTRS>
+    </CCSTMTTRNRS>
+  </CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+func TestParseOfx(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		info     map[string]string
+		rows     [][]string
+		balances []string
+	}{
+		{
+			"sgml",
+			ofxSgmlFile,
+			map[string]string{"account": "1234567890", "bank": "121000248", "currency": "USD", "type": "CHECKING"},
+			[][]string{
+				{"DEBIT", "2020-03-02", "", "-42.50", "202003020001", "", "", "", "WHOLE FOODS MARKET", "", ""},
+				{"CHECK", "2020-03-05", "", "-1200.00", "202003050001", "1001", "", "", "J & J PROPERTIES", "RENT MARCH", ""},
+				{"CREDIT", "2020-03-15", "", "2500.00", "202003150001", "", "", "", "ACME CORP PAYROLL", "", ""},
+				{"CREDIT", "2020-03-15", "", "2500.00", "202003150001", "", "", "", "ACME CORP PAYROLL", "", ""},
+			},
+			[]string{"3257.50 2020-03-31"},
+		},
+		{
+			"xml",
+			ofxXMLFile,
+			map[string]string{"account": "4111111111111111", "bank": "", "currency": "EUR", "type": ""},
+			[][]string{
+				{"DEBIT", "2020-04-03", "", "-19.99", "A1", "", "", "", "Café Müller", "", ""},
+				{"DEBIT", "2020-04-10", "", "-12.00", "A2", "", "", "", "Amazon", "", "USD"},
+			},
+			[]string{"-31.99 2020-04-30"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements, err := parseOfx(strings.NewReader(tt.file))
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			if len(statements) != 1 {
+				t.Fatalf("got %d statements, want 1", len(statements))
+			}
+
+			s := statements[0]
+
+			if !reflect.DeepEqual(s.info, tt.info) {
+				t.Errorf("got info %v, want %v", s.info, tt.info)
+			}
+
+			if !reflect.DeepEqual(s.rows, tt.rows) {
+				t.Errorf("got rows %q, want %q", s.rows, tt.rows)
+			}
+
+			var balances []string
+			for _, b := range s.balances {
+				balances = append(balances, b.amount.String()+" "+b.time.Format("2006-01-02"))
+			}
+
+			if !reflect.DeepEqual(balances, tt.balances) {
+				t.Errorf("got balances %v, want %v", balances, tt.balances)
+			}
+		})
+	}
+}
+
+func TestParseOfxWindows1252(t *testing.T) {
+	file := strings.Replace(ofxSgmlFile, "WHOLE FOODS MARKET", "CAF\xc9 M\xdcLLER \x80", 1)
+
+	statements, err := parseOfx(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	if ans := statements[0].rows[0][8]; ans != "CAFÉ MÜLLER €" {
+		t.Errorf("got %q, want %q", ans, "CAFÉ MÜLLER €")
+	}
+}
+
+func TestParseOfxErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"not ofx", "Date;Amount\n"},
+		{"no statement", "<OFX><SIGNONMSGSRSV1></SIGNONMSGSRSV1></OFX>"},
+		{"invalid amount", strings.Replace(ofxSgmlFile, "-42.50", "abc", 1)},
+		{"invalid date", strings.Replace(ofxSgmlFile, "<DTPOSTED>20200305", "<DTPOSTED>2020", 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseOfx(strings.NewReader(tt.file)); err == nil {
+				t.Errorf("got no error")
+			}
+		})
+	}
+}
+
+func TestProcessOfxFile(t *testing.T) {
+	config := DefaultConfigExample1
+	config.Csv.ProcessingAccounts = []ProcessingAccountRule{
+		{Preamble: "account", Match: regexp.MustCompile("7890$"), Account: "Assets:Checking"},
+	}
+	config.TransactionsRules = TransactionsRulesConfig{
+		TransactionRule{Name: "rent", SetAccount: "Expenses:Rent", Condition: Condition{Column: &Column{Index: -1, Name: "CHECKNUM"}, Match: regexp.MustCompile(".")}},
+		TransactionRule{Name: "salary", SetAccount: "Income:Salary", MatchPayee: "PAYROLL"},
+	}
+
+	want := `2020-03-02 * "WHOLE FOODS MARKET" "" map[fitid:202003020001]
+  Assets:Checking  -42.50 USD
+  Expenses:Unknown  42.50 USD
+2020-03-05 * "J & J PROPERTIES" "RENT MARCH" map[fitid:202003050001]
+  Assets:Checking  -1200.00 USD
+  Expenses:Rent  1200.00 USD
+2020-03-15 * "ACME CORP PAYROLL" "" map[fitid:202003150001]
+  Income:Salary  -2500.00 USD
+  Assets:Checking  2500.00 USD
+2020-04-01 balance Assets:Checking  3257.50 USD
+
+`
+
+	buf := new(bytes.Buffer)
+	processOfxFile(strings.NewReader(ofxSgmlFile), config, "{{.Date}} {{.Flag}} {{printf \"%q\" .Payee}} {{printf \"%q\" .Narration}} {{.Meta}}{{range .Postings}}\n  {{.}}{{end}}\n", buf)
+
+	if buf.String() != want {
+		t.Errorf("got %v, want %v", buf.String(), want)
+	}
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// PostingMap maps an amount column to a posting of its own, for csv files
+// with one row per event and many amount columns, such as payslips
+type PostingMap struct {
+	Account string  // The account, the one set by a rule or the default account if empty
+	Column  *Column // The amount field, nil for the posting balancing the others
+	Sign    int     // 1 to keep the sign of the amount, -1 to flip it
+}
+
+// getPostingMaps reads the posting mappings, each needing a column unless
+// it balances the others, which only one of them can
+func getPostingMaps(value interface{}) (maps []PostingMap) {
+	balancing := 0
+
+	for _, item := range cast.ToSlice(value) {
+		posting := getStringMap(item)
+
+		sign, err := parsePostingSign(cast.ToString(posting["sign"]))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"posting": posting,
+				"error":   err,
+			}).Fatal("error parsing posting sign")
+		}
+
+		m := PostingMap{
+			Account: cast.ToString(posting["account"]),
+			Sign:    sign,
+		}
+
+		if column := cast.ToString(posting["column"]); column != "" {
+			c := parseColumn(column)
+			m.Column = &c
+		} else {
+			balancing++
+		}
+
+		maps = append(maps, m)
+	}
+
+	if balancing > 1 {
+		log.WithFields(log.Fields{
+			"postings": value,
+		}).Fatal("only one posting can be without a column")
+	}
+
+	return maps
+}
+
+// parsePostingSign parses the sign of a posting mapping, e.g. + or -
+func parsePostingSign(sign string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(sign)) {
+	case "", "+", "1", "+1", "positive":
+		return 1, nil
+	case "-", "-1", "negative":
+		return -1, nil
+	}
+
+	return 0, fmt.Errorf("unknown sign %q, expected + or -", sign)
+}
+
+// mapPostings builds the postings of a record from the posting mappings,
+// skipping empty columns, and returns them with the amount posted to the
+// processing account. The posting without a column, if any, balances the
+// others, otherwise they have to balance by themselves.
+func mapPostings(record []string, config CsvConfig, commodity string) ([]Posting, Decimal, error) {
+	var postings []Posting
+	var total, processing Decimal
+
+	balancing := -1
+
+	for _, m := range config.Postings {
+		if m.Column == nil {
+			balancing = len(postings)
+			postings = append(postings, Posting{Account: m.Account, Commodity: commodity})
+
+			continue
+		}
+
+		value := m.Column.value(record)
+		if value == "" {
+			continue
+		}
+
+		amount, err := parseAmount(value, config)
+		if err != nil {
+			return nil, Decimal{}, err
+		}
+
+		if m.Sign < 0 {
+			amount = amount.Neg()
+		}
+
+		total = total.Add(amount)
+		postings = append(postings, Posting{Account: m.Account, Amount: &amount, Commodity: commodity})
+	}
+
+	if balancing >= 0 {
+		remainder := total.Neg()
+		postings[balancing].Amount = &remainder
+	} else if !total.IsZero() {
+		return nil, Decimal{}, fmt.Errorf("postings don't balance, they leave %s %s", total, commodity)
+	}
+
+	for _, posting := range postings {
+		if posting.Account == config.ProcessingAccount {
+			processing = processing.Add(*posting.Amount)
+		}
+	}
+
+	return postings, processing, nil
+}
+
+// counterAccount returns the account of the other side of a record, as set
+// by a rule or the default account
+func counterAccount(record Record, debit bool) string {
+	if debit {
+		return record.AccountIn
+	}
+
+	return record.AccountOut
+}
+
+// accountPostings fills in the account of mapped postings without one
+func accountPostings(postings []Posting, account string) []Posting {
+	for i := range postings {
+		if postings[i].Account == "" {
+			postings[i].Account = account
+		}
+	}
+
+	return postings
+}
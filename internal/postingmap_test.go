@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetPostingMaps(t *testing.T) {
+	value := []interface{}{
+		map[interface{}]interface{}{"column": "Brutto", "account": "Income:Salary", "sign": "-"},
+		map[interface{}]interface{}{"column": 3, "account": "Expenses:Taxes:Income"},
+		map[interface{}]interface{}{"account": "Assets:Bank"},
+	}
+
+	want := []PostingMap{
+		{Account: "Income:Salary", Column: &Column{Index: -1, Name: "Brutto"}, Sign: -1},
+		{Account: "Expenses:Taxes:Income", Column: &Column{Index: 3}, Sign: 1},
+		{Account: "Assets:Bank", Sign: 1},
+	}
+
+	if ans := getPostingMaps(value); !reflect.DeepEqual(ans, want) {
+		t.Errorf("got %v, want %v", ans, want)
+	}
+}
+
+func TestParsePostingSign(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  int
+		err   bool
+	}{
+		{"", 1, false},
+		{"+", 1, false},
+		{"-", -1, false},
+		{"-1", -1, false},
+		{"Negative", -1, false},
+		{"minus", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			ans, err := parsePostingSign(tt.input)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+
+			if ans != tt.want {
+				t.Errorf("got %d, want %d", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRecordPostingMaps(t *testing.T) {
+	config := DefaultConfigExample1
+	config.Csv.Description = Column{Index: 1}
+	config.Csv.Payee = Column{Index: 1}
+	config.Csv.ProcessingAccount = "Assets:Bank"
+	config.TransactionsRules = TransactionsRulesConfig{
+		TransactionRule{Name: "acme", MatchPayee: "Acme", SetAccount: "Income:Salary:Acme"},
+	}
+
+	var tests = []struct {
+		name     string
+		postings []PostingMap
+		input    []string
+		want     []string
+	}{
+		{
+			"test #1 payslip",
+			[]PostingMap{
+				{Column: &Column{Index: 2}, Sign: -1},
+				{Account: "Expenses:Taxes:Income", Column: &Column{Index: 3}, Sign: 1},
+				{Account: "Expenses:Taxes:Social", Column: &Column{Index: 4}, Sign: 1},
+				{Account: "Assets:Bank", Column: &Column{Index: 5}, Sign: 1},
+			},
+			[]string{"26.04.2019", "Acme Corp GmbH", "5.000,00", "1.000,00", "", "4.000,00"},
+			[]string{"Income:Salary:Acme  -5000.00 EUR", "Expenses:Taxes:Income  1000.00 EUR", "Assets:Bank  4000.00 EUR"},
+		},
+		{
+			"test #2 balancing posting",
+			[]PostingMap{
+				{Column: &Column{Index: 2}, Sign: -1},
+				{Account: "Expenses:Taxes:Income", Column: &Column{Index: 3}, Sign: 1},
+				{Account: "Expenses:Taxes:Social", Column: &Column{Index: 4}, Sign: 1},
+				{Account: "Assets:Bank", Sign: 1},
+			},
+			[]string{"26.04.2019", "Acme Corp GmbH", "5.000,00", "1.000,00", "500,00", ""},
+			[]string{"Income:Salary:Acme  -5000.00 EUR", "Expenses:Taxes:Income  1000.00 EUR", "Expenses:Taxes:Social  500.00 EUR", "Assets:Bank  3500.00 EUR"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Csv.Postings = tt.postings
+
+			record := formatRecord(tt.input, config)
+
+			var ans []string
+			for _, posting := range record.Postings {
+				ans = append(ans, posting.String())
+			}
+
+			if !reflect.DeepEqual(ans, tt.want) {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+
+			if record.amount.Sign() <= 0 {
+				t.Errorf("got amount %s, want the credit to the processing account", record.amount)
+			}
+		})
+	}
+}
+
+func TestMapPostingsUnbalanced(t *testing.T) {
+	config := CsvConfig{
+		Postings: []PostingMap{
+			{Account: "Income:Salary", Column: &Column{Index: 0}, Sign: -1},
+			{Account: "Assets:Bank", Column: &Column{Index: 1}, Sign: 1},
+		},
+	}
+
+	if _, _, err := mapPostings([]string{"5000.00", "4000.00"}, config, "EUR"); err == nil {
+		t.Errorf("got no error for postings that don't balance")
+	}
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// ProcessingAccountRule picks the processing account from a preamble value
+type ProcessingAccountRule struct {
+	Preamble string         // The name of the preamble value to match
+	Match    *regexp.Regexp // The pattern the value has to match
+	Account  string         // The processing account to use when it matches
+}
+
+// getPreamble compiles the patterns of the preamble values, stopping with an
+// error naming the value whose pattern is invalid
+func getPreamble(patterns map[string]string) map[string]*regexp.Regexp {
+	preamble, err := compilePreamble(patterns)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("error reading csv.preamble")
+	}
+
+	return preamble
+}
+
+// compilePreamble compiles the patterns of the preamble values
+func compilePreamble(patterns map[string]string) (map[string]*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	preamble := make(map[string]*regexp.Regexp, len(patterns))
+
+	for name, expression := range patterns {
+		pattern, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of %q: %w", name, err)
+		}
+
+		preamble[name] = pattern
+	}
+
+	return preamble, nil
+}
+
+// getProcessingAccountRules reads the rules picking the processing account,
+// stopping with an error naming the rule whose pattern is invalid
+func getProcessingAccountRules(value interface{}) []ProcessingAccountRule {
+	rules, err := compileProcessingAccountRules(value)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("error reading csv.processing_accounts")
+	}
+
+	return rules
+}
+
+// compileProcessingAccountRules reads the rules picking the processing
+// account, compiling their patterns
+func compileProcessingAccountRules(value interface{}) (rules []ProcessingAccountRule, err error) {
+	for i, item := range cast.ToSlice(value) {
+		rule := getStringMap(item)
+
+		pattern, err := regexp.Compile(cast.ToString(rule["match"]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid match pattern of rule %d: %w", i+1, err)
+		}
+
+		rules = append(rules, ProcessingAccountRule{
+			Preamble: cast.ToString(rule["preamble"]),
+			Match:    pattern,
+			Account:  cast.ToString(rule["account"]),
+		})
+	}
+
+	return rules, nil
+}
+
+// extractPreamble pulls the named values out of the rows above the csv
+// table, each value being the first capture group of its pattern (or the
+// whole match without one) on the first row the pattern matches
+func extractPreamble(rows [][]string, config CsvConfig) map[string]string {
+	values := make(map[string]string)
+
+	for name, pattern := range config.Preamble {
+		for _, row := range rows {
+			match := pattern.FindStringSubmatch(joinRecord(row, config.Separator))
+			if match == nil {
+				continue
+			}
+
+			if len(match) > 1 {
+				values[name] = match[1]
+			} else {
+				values[name] = match[0]
+			}
+
+			break
+		}
+
+		log.WithFields(log.Fields{
+			"name":       name,
+			"expression": pattern,
+			"value":      values[name],
+		}).Trace("extracted preamble value")
+	}
+
+	return values
+}
+
+// getProcessingAccount returns the account of the first rule matching its
+// preamble value, or the configured processing account if none match
+func getProcessingAccount(values map[string]string, config CsvConfig) string {
+	for _, rule := range config.ProcessingAccounts {
+		value, ok := values[rule.Preamble]
+		if !ok {
+			continue
+		}
+
+		if rule.Match != nil && rule.Match.MatchString(value) {
+			log.WithFields(log.Fields{
+				"preamble": rule.Preamble,
+				"value":    value,
+				"account":  rule.Account,
+			}).Debug("processing account picked from preamble")
+
+			return rule.Account
+		}
+	}
+
+	return config.ProcessingAccount
+}
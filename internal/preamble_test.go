@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var INGDiBaPreamble = map[string]*regexp.Regexp{
+	"iban":    regexp.MustCompile("^IBAN;(.+)$"),
+	"name":    regexp.MustCompile("^Kontoname;(.+)$"),
+	"period":  regexp.MustCompile("^Zeitraum;(.+)$"),
+	"balance": regexp.MustCompile("^Saldo;([^;]+);"),
+	"missing": regexp.MustCompile("^BIC;(.+)$"),
+}
+
+func TestExtractPreamble(t *testing.T) {
+	r, _, err := getCsvReader(strings.NewReader(INGDiBaCsvFile), CsvConfig{Separator: ';', SkipUntil: "^Buchung;"})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	want := map[string]string{
+		"iban":    "DE91 1000 0000 0123 4567 89",
+		"name":    "Cash",
+		"period":  "01.04.2001 - 31.12.2000",
+		"balance": "616,69",
+	}
+
+	ans := extractPreamble(r.preamble, CsvConfig{Separator: ';', Preamble: INGDiBaPreamble})
+	if !reflect.DeepEqual(ans, want) {
+		t.Errorf("got %v, want %v", ans, want)
+	}
+}
+
+func TestGetProcessingAccount(t *testing.T) {
+	rules := []ProcessingAccountRule{
+		{Preamble: "iban", Match: regexp.MustCompile("^DE12"), Account: "Assets:ING:Extra"},
+		{Preamble: "iban", Match: regexp.MustCompile("^DE91 1000"), Account: "Assets:ING:Giro"},
+	}
+
+	var tests = []struct {
+		name   string
+		values map[string]string
+		want   string
+	}{
+		{"test #1 matching rule", map[string]string{"iban": "DE91 1000 0000 0123 4567 89"}, "Assets:ING:Giro"},
+		{"test #2 no rule matches", map[string]string{"iban": "DE55 1000 0000 0123 4567 89"}, "Assets:Unknown"},
+		{"test #3 no preamble value", map[string]string{}, "Assets:Unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ans := getProcessingAccount(tt.values, CsvConfig{ProcessingAccount: "Assets:Unknown", ProcessingAccounts: rules})
+			if ans != tt.want {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessCsvFilePreamble(t *testing.T) {
+	config := DefaultConfigExample1
+	config.Csv.Skip = 0
+	config.Csv.SkipUntil = "^Buchung;"
+	config.Csv.Preamble = INGDiBaPreamble
+	config.Csv.ProcessingAccounts = []ProcessingAccountRule{
+		{Preamble: "iban", Match: regexp.MustCompile("^DE91 1000"), Account: "Assets:ING:Giro"},
+	}
+	config.TransactionsRules = TransactionsRulesConfig{}
+
+	buf := new(bytes.Buffer)
+	processCsvFile(strings.NewReader(INGDiBaCsvFile), config, "{{.Date}} {{.Preamble.name}} {{.AccountIn}}\n", buf)
+
+	want := "2019-04-26 Cash Assets:ING:Giro\n2019-04-24 Cash Expenses:Unknown\n"
+	if !strings.HasPrefix(buf.String(), want) {
+		t.Errorf("got %v, want it to start with %v", buf.String(), want)
+	}
+}
+
+func TestCompilePreambleErrors(t *testing.T) {
+	if _, err := compilePreamble(map[string]string{"iban": "^IBAN;(.+$"}); err == nil {
+		t.Errorf("got no error for an invalid preamble pattern")
+	}
+
+	rules := []interface{}{
+		map[string]interface{}{"preamble": "iban", "match": "^DE91", "account": "Assets:ING:Giro"},
+		map[string]interface{}{"preamble": "iban", "match": "^DE12[", "account": "Assets:ING:Extra"},
+	}
+
+	if _, err := compileProcessingAccountRules(rules); err == nil {
+		t.Errorf("got no error for an invalid processing account pattern")
+	}
+
+	ans, err := compileProcessingAccountRules(rules[:1])
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	if len(ans) != 1 || ans[0].Account != "Assets:ING:Giro" || !ans[0].Match.MatchString("DE91 1000") {
+		t.Errorf("got %v", ans)
+	}
+}
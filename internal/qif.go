@@ -0,0 +1,418 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// qifHeader names the fields of the rows of qif statements
+var qifHeader = []string{"Date", "Amount", "Payee", "Memo", "Category", "Number", "Cleared", "Address", "Split", "Action", "Security", "Price", "Quantity", "Commission", "Transfer", "Value", "SplitMemo"}
+
+// qifColumns are the fields of qif statements the records are taken from
+var qifColumns = statementColumns{
+	amount:      "Amount",
+	date:        "Date",
+	description: "Memo",
+	group:       "Split",
+	payee:       "Payee",
+}
+
+// qifBrokerage converts the buys and sells of investment statements
+var qifBrokerage = BrokerageConfig{
+	Action:          &Column{Index: -1, Name: "Action"},
+	Booking:         BookingEmpty,
+	Buy:             []string{"Buy", "BuyX"},
+	GainsAccount:    "Income:Capital-Gains",
+	HoldingsAccount: "Assets:Broker:{symbol}",
+	Price:           Column{Index: -1, Name: "Price"},
+	Quantity:        Column{Index: -1, Name: "Quantity"},
+	Sell:            []string{"Sell", "SellX"},
+	Symbol:          Column{Index: -1, Name: "Security"},
+	Value:           &Column{Index: -1, Name: "Value"},
+}
+
+// qifFees are the fees of investment statements
+var qifFees = []Fee{
+	{Account: "Expenses:Commissions", Column: Column{Index: -1, Name: "Commission"}},
+}
+
+var (
+	// qifCashIn are the investment actions putting cash into the account
+	qifCashIn = []string{"Sell", "SellX", "Div", "DivX", "IntInc", "IntIncX", "CGLong", "CGLongX", "CGMid", "CGMidX", "CGShort", "CGShortX", "MiscInc", "MiscIncX", "RtrnCap", "RtrnCapX", "XIn"}
+	// qifCashOut are the investment actions taking cash out of the account
+	qifCashOut = []string{"Buy", "BuyX", "MiscExp", "MiscExpX", "MargInt", "MargIntX", "XOut"}
+	// qifDateLayouts are the layouts qif dates are tried with, unless the
+	// date layout is configured
+	qifDateLayouts = []string{"1/2/2006", "1/2/06", "2.1.2006", "2.1.06", "2006-01-02"}
+)
+
+// qifLine is a line of a qif record, its code being its first character
+type qifLine struct {
+	code  byte   // The code, e.g. T for the amount
+	value string // The rest of the line
+}
+
+// ProcessQifFile ...
+func ProcessQifFile(file io.Reader, config Config, template string) {
+	processQifFile(file, config, template, os.Stdout)
+}
+
+// processQifFile converts every bank, cash, credit card and investment
+// section of a qif file, the transactions of each being converted like the
+// rows of a csv file
+func processQifFile(file io.Reader, config Config, template string, output io.Writer) {
+	statements, err := parseQif(file, config.Csv)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("error reading qif file")
+	}
+
+	for _, s := range statements {
+		processStatement(s, config, template, output)
+	}
+}
+
+// parseQif reads the sections of a qif file, each starting with a !Type
+// line, the account of a section being the one named by an !Account record
+// before it. Dates are parsed with the configured date layout, and amounts
+// with the configured separators.
+func parseQif(file io.Reader, config CsvConfig) ([]statement, error) {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := decodeStatement(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []statement
+	var current *statement
+	var account string
+	var lines []qifLine
+
+	// the records of lists and of !Account are skipped or only read for
+	// the account name, rather than converted
+	listing, accounts := false, false
+
+	rows := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	if config, err = detectSeparators(qifAmounts(rows), config); err != nil {
+		return nil, err
+	}
+
+	for i, line := range rows {
+		line = strings.TrimRight(line, "\r")
+
+		switch {
+		case strings.TrimSpace(line) == "":
+		case strings.HasPrefix(line, "!"):
+			header := strings.TrimSpace(line[1:])
+			accounts = strings.EqualFold(header, "Account")
+			listing = false
+
+			if !strings.HasPrefix(strings.ToLower(header), "type:") {
+				break
+			}
+
+			switch kind := strings.TrimSpace(header[len("type:"):]); strings.ToLower(kind) {
+			case "bank", "cash", "ccard", "oth a", "oth l", "invst":
+				statements = append(statements, qifStatement(kind, account))
+				current = &statements[len(statements)-1]
+			default:
+				listing = true
+				current = nil
+			}
+		case strings.HasPrefix(line, "^"):
+			switch {
+			case accounts:
+				for _, l := range lines {
+					if l.code == 'N' {
+						account = l.value
+					}
+				}
+			case current != nil && !listing && len(lines) > 0:
+				if err := current.addQifRecord(lines, config); err != nil {
+					return nil, fmt.Errorf("record ending on line %d: %v", i+1, err)
+				}
+			}
+
+			lines = nil
+		default:
+			lines = append(lines, qifLine{line[0], strings.TrimSpace(line[1:])})
+		}
+	}
+
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("no bank, credit card or investment section found")
+	}
+
+	return statements, nil
+}
+
+// qifAmounts returns the values of the amount, price, quantity and
+// commission lines of a qif file, which its separators are detected from
+func qifAmounts(rows []string) []string {
+	var values []string
+
+	for _, row := range rows {
+		if row != "" && strings.ContainsRune("TU$IQO", rune(row[0])) {
+			values = append(values, strings.TrimSpace(row[1:]))
+		}
+	}
+
+	return values
+}
+
+// qifStatement returns an empty statement for a section of the given type
+func qifStatement(kind, account string) statement {
+	s := statement{
+		columns: qifColumns,
+		header:  qifHeader,
+		info: map[string]string{
+			"account": account,
+			"type":    kind,
+		},
+	}
+
+	if strings.EqualFold(kind, "invst") {
+		s.brokerage = &qifBrokerage
+		s.fees = qifFees
+	}
+
+	return s
+}
+
+// addQifRecord adds the rows of a record to the statement. A record with
+// split lines adds a row for each split, sharing the Split field so they're
+// merged back into one transaction and keeping the memo of the record, the
+// memo of the split being the SplitMemo. Investment records are signed by
+// their action.
+func (s *statement) addQifRecord(lines []qifLine, config CsvConfig) error {
+	fields := make(map[string]string)
+
+	type split struct {
+		amount, category, memo string
+	}
+
+	var splits []split
+	var address []string
+
+	for _, line := range lines {
+		switch line.code {
+		case 'D':
+			t, err := parseQifDate(line.value, config)
+			if err != nil {
+				return err
+			}
+
+			fields["Date"] = t.Format(StatementDateLayout)
+		case 'T', 'U':
+			fields["Amount"] = line.value
+		case 'P':
+			fields["Payee"] = line.value
+		case 'M':
+			fields["Memo"] = line.value
+		case 'L':
+			fields["Category"] = line.value
+		case 'C':
+			fields["Cleared"] = line.value
+		case 'A':
+			address = append(address, line.value)
+		case 'N':
+			if s.brokerage != nil {
+				fields["Action"] = line.value
+			} else {
+				fields["Number"] = line.value
+			}
+		case 'Y':
+			fields["Security"] = line.value
+		case 'I':
+			fields["Price"] = line.value
+		case 'Q':
+			fields["Quantity"] = line.value
+		case 'O':
+			fields["Commission"] = line.value
+		case 'S':
+			splits = append(splits, split{category: line.value})
+		case 'E':
+			if len(splits) > 0 {
+				splits[len(splits)-1].memo = line.value
+			}
+		case '$':
+			if len(splits) > 0 {
+				splits[len(splits)-1].amount = line.value
+			} else {
+				fields["Transfer"] = line.value
+			}
+		}
+	}
+
+	fields["Address"] = strings.Join(address, ", ")
+
+	if fields["Date"] == "" {
+		return fmt.Errorf("missing date")
+	}
+
+	if err := s.normalizeQif(fields, config); err != nil {
+		return err
+	}
+
+	if len(splits) == 0 {
+		s.rows = append(s.rows, qifRow(fields))
+
+		return nil
+	}
+
+	group := strconv.Itoa(len(s.rows) + 1)
+
+	var total Decimal
+
+	for _, split := range splits {
+		value, err := parseAmount(split.amount, config)
+		if err != nil {
+			return fmt.Errorf("split %q: %v", split.category, err)
+		}
+
+		total = total.Add(value)
+
+		row := make(map[string]string, len(fields))
+		for name, field := range fields {
+			row[name] = field
+		}
+
+		row["Amount"] = value.String()
+		row["Category"] = split.category
+		row["Split"] = group
+		row["SplitMemo"] = split.memo
+
+		s.rows = append(s.rows, qifRow(row))
+	}
+
+	if amount, _ := ParseDecimal(fields["Amount"]); total.Cmp(amount) != 0 {
+		log.WithFields(log.Fields{
+			"date":   fields["Date"],
+			"payee":  fields["Payee"],
+			"amount": fields["Amount"],
+			"splits": total,
+		}).Warn("the splits don't add up to the amount of the transaction")
+	}
+
+	return nil
+}
+
+// normalizeQif normalizes the amounts, prices, quantities and commissions
+// of a record, investment records being signed by their action. The value
+// of the shares of a buy or a sell is worked out from its amount and
+// commission, so the cash leg is booked from the amount exactly, and the
+// price of one without a price from its value and quantity.
+func (s statement) normalizeQif(fields map[string]string, config CsvConfig) error {
+	numbers := make(map[string]Decimal)
+
+	for _, name := range []string{"Amount", "Commission", "Price", "Quantity", "Transfer"} {
+		if fields[name] == "" {
+			continue
+		}
+
+		number, err := parseAmount(fields[name], config)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", strings.ToLower(name), err)
+		}
+
+		numbers[name] = number
+	}
+
+	amount := numbers["Amount"]
+	action := fields["Action"]
+
+	if s.brokerage != nil {
+		switch {
+		case containsFold(qifCashIn, action):
+			amount = amount.Abs()
+		case containsFold(qifCashOut, action):
+			amount = amount.Abs().Neg()
+		}
+	}
+
+	fields["Amount"] = amount.String()
+
+	for name, number := range numbers {
+		if name != "Amount" {
+			fields[name] = number.String()
+		}
+	}
+
+	buy := s.brokerage != nil && containsFold(s.brokerage.Buy, action)
+	sell := s.brokerage != nil && containsFold(s.brokerage.Sell, action)
+
+	if !(buy || sell) {
+		return nil
+	}
+
+	// the amount of a buy includes the commission, that of a sell is net of it
+	commission := numbers["Commission"].Abs()
+	if buy {
+		commission = commission.Neg()
+	}
+
+	value := amount.Abs().Add(commission)
+	fields["Value"] = value.String()
+
+	quantity, ok := numbers["Quantity"]
+	if fields["Price"] != "" || !ok || quantity.IsZero() {
+		return nil
+	}
+
+	price, err := value.Quo(quantity.Abs(), 8)
+	if err != nil {
+		return err
+	}
+
+	fields["Price"] = price.trim().String()
+
+	return nil
+}
+
+// qifRow lays out the fields of a record as a row of the qifHeader fields
+func qifRow(fields map[string]string) []string {
+	row := make([]string, len(qifHeader))
+	for i, name := range qifHeader {
+		row[i] = fields[name]
+	}
+
+	return row
+}
+
+// parseQifDate parses a qif date with the configured qif date layout, or
+// with any of the common layouts once Quicken's apostrophe before the year
+// of 2000 and later dates, and any spaces padding the day and month, are
+// taken out
+func parseQifDate(value string, config CsvConfig) (time.Time, error) {
+	if config.QifDateLayout != "" {
+		t, err := time.Parse(config.QifDateLayout, strings.TrimSpace(value))
+		if err != nil {
+			return t, fmt.Errorf("invalid date %q", value)
+		}
+
+		return t, nil
+	}
+
+	normalized := strings.ReplaceAll(strings.ReplaceAll(value, "'", "/"), " ", "")
+
+	for _, layout := range qifDateLayouts {
+		if t, err := time.Parse(layout, normalized); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
@@ -0,0 +1,257 @@
+package internal
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var qifFile = `!Option:AutoSwitch
+!Account
+NChecking
+TBank
+^
+!Clear:AutoSwitch
+!Type:Bank
+D3/ 2'20
+T-1,042.50
+PSafeway
+MWeekly shop
+LGroceries
+N1001
+CX
+^
+D3/15'20
+T2,500.00
+PAcme Corp
+LSalary
+^
+D3/20'20
+T-150.00
+PCostco
+MMixed
+SGroceries
+EFood
+$-100.00
+SHousehold
+$-50.00
+^
+!Type:Cat
+NGroceries
+E
+^
+`
+
+var qifInvstFile = `!Type:Invst
+D4/1/2020
+NBuy
+YVWRL
+I80.00
+Q10
+T805.00
+O5.00
+^
+D5/1/2020
+NSell
+YVWRL
+Q4
+T376.00
+O4.00
+^
+D6/1/2020
+NDiv
+YVWRL
+T12.34
+^
+D7/1/2020
+NBuy
+YVWRL
+Q3
+T101.00
+O1.00
+^
+`
+
+func TestParseQif(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		info map[string]string
+		rows [][]string
+	}{
+		{
+			"bank",
+			qifFile,
+			map[string]string{"account": "Checking", "type": "Bank"},
+			[][]string{
+				{"2020-03-02", "-1042.50", "Safeway", "Weekly shop", "Groceries", "1001", "X", "", "", "", "", "", "", "", "", "", ""},
+				{"2020-03-15", "2500.00", "Acme Corp", "", "Salary", "", "", "", "", "", "", "", "", "", "", "", ""},
+				{"2020-03-20", "-100.00", "Costco", "Mixed", "Groceries", "", "", "", "3", "", "", "", "", "", "", "", "Food"},
+				{"2020-03-20", "-50.00", "Costco", "Mixed", "Household", "", "", "", "3", "", "", "", "", "", "", "", ""},
+			},
+		},
+		{
+			"invst",
+			qifInvstFile,
+			map[string]string{"account": "", "type": "Invst"},
+			[][]string{
+				{"2020-04-01", "-805.00", "", "", "", "", "", "", "", "Buy", "VWRL", "80.00", "10", "5.00", "", "800.00", ""},
+				{"2020-05-01", "376.00", "", "", "", "", "", "", "", "Sell", "VWRL", "95", "4", "4.00", "", "380.00", ""},
+				{"2020-06-01", "12.34", "", "", "", "", "", "", "", "Div", "VWRL", "", "", "", "", "", ""},
+				{"2020-07-01", "-101.00", "", "", "", "", "", "", "", "Buy", "VWRL", "33.33333333", "3", "1.00", "", "100.00", ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements, err := parseQif(strings.NewReader(tt.file), CsvConfig{})
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			if len(statements) != 1 {
+				t.Fatalf("got %d statements, want 1", len(statements))
+			}
+
+			if !reflect.DeepEqual(statements[0].info, tt.info) {
+				t.Errorf("got info %v, want %v", statements[0].info, tt.info)
+			}
+
+			if !reflect.DeepEqual(statements[0].rows, tt.rows) {
+				t.Errorf("got rows %q, want %q", statements[0].rows, tt.rows)
+			}
+		})
+	}
+}
+
+func TestParseQifDate(t *testing.T) {
+	tests := []struct {
+		value  string
+		layout string
+		want   string
+	}{
+		{"3/ 2'20", "", "2020-03-02"},
+		{"12/31/99", "", "1999-12-31"},
+		{"12/31/1999", "", "1999-12-31"},
+		{"31.12.2019", "", "2019-12-31"},
+		{"2019-12-31", "", "2019-12-31"},
+		{"02/03/2020", "02/01/2006", "2020-03-02"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			ans, err := parseQifDate(tt.value, CsvConfig{QifDateLayout: tt.layout})
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			if ans.Format(StatementDateLayout) != tt.want {
+				t.Errorf("got %v, want %v", ans.Format(StatementDateLayout), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQifErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"no section", "!Type:Cat\nNGroceries\n^\n"},
+		{"invalid date", strings.Replace(qifFile, "D3/15'20", "D15/15'20", 1)},
+		{"missing date", strings.Replace(qifFile, "D3/15'20\n", "", 1)},
+		{"invalid amount", strings.Replace(qifFile, "T2,500.00", "Tabc", 1)},
+		{"invalid split", strings.Replace(qifFile, "$-50.00", "$abc", 1)},
+		{"different separators", strings.Replace(qifFile, "T2,500.00", "T2.500,00", 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseQif(strings.NewReader(tt.file), CsvConfig{}); err == nil {
+				t.Errorf("got no error")
+			}
+		})
+	}
+}
+
+func TestProcessQifFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		config func(Config) Config
+		want   string
+	}{
+		{
+			"bank",
+			qifFile,
+			func(config Config) Config {
+				config.Csv.ProcessingAccounts = []ProcessingAccountRule{
+					{Preamble: "account", Match: regexp.MustCompile("^Checking$"), Account: "Assets:Checking"},
+				}
+				config.TransactionsRules = TransactionsRulesConfig{
+					TransactionRule{Name: "food", SetAccount: "Expenses:Food", Condition: Condition{Column: &Column{Index: -1, Name: "SplitMemo"}, Match: regexp.MustCompile("^Food$")}},
+					TransactionRule{Name: "categories", SetAccount: "Expenses:$1", Condition: Condition{Column: &Column{Index: -1, Name: "Category"}, Match: regexp.MustCompile("^(Groceries|Household)$")}},
+					TransactionRule{Name: "salary", SetAccount: "Income:Salary", Condition: Condition{Column: &Column{Index: -1, Name: "Category"}, Match: regexp.MustCompile("^Salary$")}},
+				}
+
+				return config
+			},
+			`2020-03-02 "Safeway" "Weekly shop"
+  Assets:Checking  -1042.50 EUR
+  Expenses:Groceries  1042.50 EUR
+2020-03-15 "Acme Corp" ""
+  Income:Salary  -2500.00 EUR
+  Assets:Checking  2500.00 EUR
+2020-03-20 "Costco" "Mixed"
+  Assets:Checking  -150.00 EUR
+  Expenses:Food  100.00 EUR
+  Expenses:Household  50.00 EUR
+`,
+		},
+		{
+			"invst",
+			qifInvstFile,
+			func(config Config) Config {
+				config.Csv.Brokerage = &BrokerageConfig{Booking: BookingFIFO, HoldingsAccount: "Assets:Broker:{symbol}", GainsAccount: "Income:Gains"}
+				config.Csv.Fees = []Fee{{Account: "Expenses:Broker:Fees", Column: Column{Index: -1, Name: "Commission"}}}
+				config.Csv.ProcessingAccount = "Assets:Broker:Cash"
+				config.TransactionsRules = TransactionsRulesConfig{
+					TransactionRule{Name: "dividends", SetAccount: "Income:Dividends", Condition: Condition{Column: &Column{Index: -1, Name: "Action"}, Match: regexp.MustCompile("^Div$")}},
+				}
+
+				return config
+			},
+			`2020-04-01 "" ""
+  Assets:Broker:VWRL  10 VWRL {80.00 EUR}
+  Expenses:Broker:Fees  5.00 EUR
+  Assets:Broker:Cash  -805.00 EUR
+2020-05-01 "" ""
+  Assets:Broker:VWRL  -4 VWRL {80.00 EUR, 2020-04-01} @ 95 EUR
+  Expenses:Broker:Fees  4.00 EUR
+  Assets:Broker:Cash  376.00 EUR
+  Income:Gains  -60.00 EUR
+2020-06-01 "" ""
+  Income:Dividends  -12.34 EUR
+  Assets:Broker:Cash  12.34 EUR
+2020-07-01 "" ""
+  Assets:Broker:VWRL  3 VWRL {33.33333333 EUR}
+  Expenses:Broker:Fees  1.00 EUR
+  Assets:Broker:Cash  -101.00 EUR
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			processQifFile(strings.NewReader(tt.file), tt.config(DefaultConfigExample1), "{{.Date}} {{printf \"%q\" .Payee}} {{printf \"%q\" .Narration}}{{range .Postings}}\n  {{.}}{{end}}\n", buf)
+
+			if buf.String() != tt.want {
+				t.Errorf("got %v, want %v", buf.String(), tt.want)
+			}
+		})
+	}
+}
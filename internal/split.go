@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// SplitLeg is a share of a transaction split off into its own account
+type SplitLeg struct {
+	Account string   // The account of this share
+	Amount  *Decimal // A fixed amount, in the direction of the posting being split
+	Percent *Decimal // A percentage of the amount of the posting being split
+}
+
+// getSplit reads the split legs of a rule, each needing either an amount
+// or a percentage
+func getSplit(name string, value interface{}) (legs []SplitLeg) {
+	for _, item := range cast.ToSlice(value) {
+		leg := getStringMap(item)
+
+		split := SplitLeg{
+			Account: cast.ToString(leg["account"]),
+			Amount:  getSplitDecimal(name, leg, "amount"),
+			Percent: getSplitDecimal(name, leg, "percent"),
+		}
+
+		if split.Account == "" || (split.Amount == nil) == (split.Percent == nil) {
+			log.WithFields(log.Fields{
+				"rule":  name,
+				"split": leg,
+			}).Fatal("split legs need an account, and either an amount or a percent")
+		}
+
+		legs = append(legs, split)
+	}
+
+	return legs
+}
+
+// getSplitDecimal parses a number of a split leg, nil if it isn't set
+func getSplitDecimal(name string, leg map[string]interface{}, key string) *Decimal {
+	value := cast.ToString(leg[key])
+	if value == "" {
+		return nil
+	}
+
+	d, err := ParseDecimal(value)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"rule":  name,
+			"split": leg,
+			"error": err,
+		}).Fatal("error parsing split " + key)
+	}
+
+	return &d
+}
+
+// splitPosting spreads a posting across the split legs, percentages being
+// rounded half away from zero to the posting's precision. The remainder,
+// rounding included, stays with the posting's own account so that the
+// transaction always balances exactly.
+func splitPosting(posting Posting, legs []SplitLeg) ([]Posting, error) {
+	if posting.Amount == nil {
+		return nil, fmt.Errorf("posting to %s has no amount", posting.Account)
+	}
+
+	total := *posting.Amount
+
+	scale := total.Scale()
+	for _, leg := range legs {
+		if leg.Amount != nil && leg.Amount.Scale() > scale {
+			scale = leg.Amount.Scale()
+		}
+	}
+
+	var postings []Posting
+
+	remainder := total
+
+	for _, leg := range legs {
+		var share Decimal
+
+		if leg.Amount != nil {
+			share = *leg.Amount
+
+			// fixed amounts follow the direction of the posting
+			if total.Sign() < 0 {
+				share = share.Neg()
+			}
+		} else {
+			var err error
+
+			share, err = total.Mul(*leg.Percent).Quo(NewDecimal(100, 0), scale)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		share = share.Round(scale)
+		remainder = remainder.Sub(share)
+
+		postings = append(postings, Posting{Account: leg.Account, Amount: &share, Commodity: posting.Commodity})
+	}
+
+	if !remainder.IsZero() {
+		remainder = remainder.Round(scale)
+		posting.Amount = &remainder
+		postings = append(postings, posting)
+	}
+
+	return postings, nil
+}
+
+// splitRecordPosting splits the other side of a record, falling back to
+// the unsplit posting when its amount can't be split
+func splitRecordPosting(posting Posting, legs []SplitLeg) []Posting {
+	postings, err := splitPosting(posting, legs)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"posting": posting,
+			"error":   err,
+		}).Warn("error splitting posting")
+
+		return []Posting{posting}
+	}
+
+	return postings
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitPosting(t *testing.T) {
+	var tests = []struct {
+		name    string
+		posting Posting
+		legs    []SplitLeg
+		want    []Posting
+	}{
+		{
+			"test #1 shared rent",
+			Posting{Account: "Expenses:Rent", Amount: mustDecimalPtr("1250.01"), Commodity: "EUR"},
+			[]SplitLeg{{Account: "Assets:Receivable:Flatmate", Percent: mustDecimalPtr("50")}},
+			[]Posting{
+				{Account: "Assets:Receivable:Flatmate", Amount: mustDecimalPtr("625.01"), Commodity: "EUR"},
+				{Account: "Expenses:Rent", Amount: mustDecimalPtr("625.00"), Commodity: "EUR"},
+			},
+		},
+		{
+			"test #2 fixed fee on a credit",
+			Posting{Account: "Income:Sales", Amount: mustDecimalPtr("-100.00"), Commodity: "EUR"},
+			[]SplitLeg{{Account: "Expenses:Fees", Amount: mustDecimalPtr("5.00")}},
+			[]Posting{
+				{Account: "Expenses:Fees", Amount: mustDecimalPtr("-5.00"), Commodity: "EUR"},
+				{Account: "Income:Sales", Amount: mustDecimalPtr("-95.00"), Commodity: "EUR"},
+			},
+		},
+		{
+			"test #3 thirds leave the rounding with the posting",
+			Posting{Account: "Expenses:Dinner", Amount: mustDecimalPtr("100.00"), Commodity: "EUR"},
+			[]SplitLeg{
+				{Account: "Assets:Receivable:Anna", Percent: mustDecimalPtr("33.33")},
+				{Account: "Assets:Receivable:Ben", Percent: mustDecimalPtr("33.33")},
+				{Account: "Assets:Receivable:Cleo", Percent: mustDecimalPtr("33.34")},
+			},
+			[]Posting{
+				{Account: "Assets:Receivable:Anna", Amount: mustDecimalPtr("33.33"), Commodity: "EUR"},
+				{Account: "Assets:Receivable:Ben", Amount: mustDecimalPtr("33.33"), Commodity: "EUR"},
+				{Account: "Assets:Receivable:Cleo", Amount: mustDecimalPtr("33.34"), Commodity: "EUR"},
+			},
+		},
+		{
+			"test #4 half cents round away from zero",
+			Posting{Account: "Expenses:Dinner", Amount: mustDecimalPtr("-0.05"), Commodity: "EUR"},
+			[]SplitLeg{
+				{Account: "Assets:Receivable:Anna", Percent: mustDecimalPtr("50")},
+			},
+			[]Posting{
+				{Account: "Assets:Receivable:Anna", Amount: mustDecimalPtr("-0.03"), Commodity: "EUR"},
+				{Account: "Expenses:Dinner", Amount: mustDecimalPtr("-0.02"), Commodity: "EUR"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ans, err := splitPosting(tt.posting, tt.legs)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			if !reflect.DeepEqual(ans, tt.want) {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRecordSplit(t *testing.T) {
+	config := DefaultConfigExample1
+	config.TransactionsRules = TransactionsRulesConfig{
+		TransactionRule{
+			Name:       "card fee",
+			SetAccount: "Expenses:Travel",
+			MatchPayee: "RYANAIR",
+			Split:      []SplitLeg{{Account: "Expenses:Bank:Fees", Amount: mustDecimalPtr("5.00")}},
+		},
+	}
+
+	record := formatRecord([]string{"24.04.2019", "29.04.2019", "VISA RYANAIR", "Lastschrift", "NR8123456015", "6.823,05", "EUR", "-16,00", "EUR"}, config)
+
+	want := []Posting{
+		{Account: "Assets:Unknown", Amount: mustDecimalPtr("-16.00"), Commodity: "EUR"},
+		{Account: "Expenses:Bank:Fees", Amount: mustDecimalPtr("5.00"), Commodity: "EUR"},
+		{Account: "Expenses:Travel", Amount: mustDecimalPtr("11.00"), Commodity: "EUR"},
+	}
+
+	if !reflect.DeepEqual(record.Postings, want) {
+		t.Errorf("got %v, want %v", record.Postings, want)
+	}
+}
@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// spreadsheet is a workbook read from an xlsx or ods file, each of its
+// sheets laid out as rows like those of a csv file
+type spreadsheet struct {
+	names  []string     // The names of the sheets, in the order of the workbook
+	sheets [][][]string // The rows of each sheet, empty rows left out
+}
+
+// sheetReader reads the rows of a sheet one by one, like a csv.Reader
+type sheetReader struct {
+	rows [][]string // The rows not read yet
+}
+
+// Read returns the next row of the sheet
+func (r *sheetReader) Read() ([]string, error) {
+	if len(r.rows) == 0 {
+		return nil, io.EOF
+	}
+
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+
+	return row, nil
+}
+
+// processSpreadsheet converts the configured sheet of a spreadsheet, its
+// rows being skipped, matched by header name and converted like the rows of
+// a csv file
+func processSpreadsheet(book spreadsheet, config Config, template string, output io.Writer) {
+	rows, err := book.sheet(config.Csv.Sheet)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"sheets": book.names,
+			"error":  err,
+		}).Fatal("error picking the sheet")
+	}
+
+	r, header, err := getTableReader(&sheetReader{rows: rows}, config.Csv)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("error skipping to the sheet's table")
+	}
+
+	processTable(r, header, config, template, output)
+}
+
+// sheet returns the rows of a sheet picked by its name, ignoring case if no
+// name matches exactly, or by its number counting from 1, the first sheet if
+// none is picked
+func (s spreadsheet) sheet(name string) ([][]string, error) {
+	if len(s.sheets) == 0 {
+		return nil, fmt.Errorf("no sheet found")
+	}
+
+	if name == "" {
+		return s.sheets[0], nil
+	}
+
+	for i, sheet := range s.names {
+		if sheet == name {
+			return s.sheets[i], nil
+		}
+	}
+
+	for i, sheet := range s.names {
+		if strings.EqualFold(sheet, name) {
+			return s.sheets[i], nil
+		}
+	}
+
+	if number, err := strconv.Atoi(name); err == nil && number >= 1 && number <= len(s.sheets) {
+		return s.sheets[number-1], nil
+	}
+
+	return nil, fmt.Errorf("no sheet %q found", name)
+}
+
+// spreadsheetConfig returns the config spreadsheets are read with, dates
+// being written in the StatementDateLayout when no date layout is configured
+func spreadsheetConfig(config CsvConfig) CsvConfig {
+	if config.DateLayoutIn == "" {
+		config.DateLayoutIn = StatementDateLayout
+	}
+
+	return config
+}
+
+// openZip reads the zip archive an xlsx or ods file is
+func openZip(file io.Reader) (*zip.Reader, error) {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// readZipFile returns the content of a file in a zip archive, or nil if
+// there's no such file
+func readZipFile(archive *zip.Reader, name string) ([]byte, error) {
+	for _, f := range archive.File {
+		if f.Name != name {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		return ioutil.ReadAll(r)
+	}
+
+	return nil, nil
+}
+
+// formatSheetNumber writes the value of a numeric cell the way amounts are
+// configured to be written, with the configured decimal separator, a dot if
+// none is, and negative style, so numbers don't depend on how the cell is
+// displayed. The decimal separator of text cells is still detected.
+func formatSheetNumber(value string, config CsvConfig) (string, error) {
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid number %q", value)
+	}
+
+	// spreadsheets keep 15 significant digits, the rest being the noise of
+	// binary floating point, e.g. 0.30000000000000004 for 0.1+0.2
+	str := strconv.FormatFloat(number, 'g', 15, 64)
+	if number, err = strconv.ParseFloat(str, 64); err == nil {
+		str = strconv.FormatFloat(number, 'f', -1, 64)
+	}
+
+	decimal, _, err := amountSeparators(config)
+	if err != nil {
+		return "", err
+	}
+
+	if decimal != "" {
+		str = strings.Replace(str, ".", decimal, 1)
+	}
+
+	if !strings.HasPrefix(str, "-") {
+		return str, nil
+	}
+
+	switch strings.ToLower(config.NegativeStyle) {
+	case NegativeParentheses:
+		return "(" + str[1:] + ")", nil
+	case NegativeTrailing:
+		return str[1:] + "-", nil
+	}
+
+	return str, nil
+}
+
+// formatSheetDate writes the value of a date cell in the date layout
+func formatSheetDate(t time.Time, config CsvConfig) string {
+	return t.Format(config.DateLayoutIn)
+}
+
+// sheetRow drops the empty cells at the end of a row, returning nil for a
+// row without any value
+func sheetRow(row []string) []string {
+	for len(row) > 0 && row[len(row)-1] == "" {
+		row = row[:len(row)-1]
+	}
+
+	if len(row) == 0 {
+		return nil
+	}
+
+	return row
+}
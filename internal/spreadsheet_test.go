@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// zipFile returns a zip archive of the given files, as an xlsx or ods file
+// is one
+func zipFile(t *testing.T, files map[string]string) *bytes.Reader {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestSpreadsheetSheet(t *testing.T) {
+	book := spreadsheet{
+		names:  []string{"Info", "Umsätze", "2"},
+		sheets: [][][]string{{{"info"}}, {{"umsätze"}}, {{"two"}}},
+	}
+
+	tests := []struct {
+		name string
+		want string
+		err  bool
+	}{
+		{"", "info", false},
+		{"Umsätze", "umsätze", false},
+		{"UMSÄTZE", "umsätze", false},
+		{"1", "info", false},
+		{"2", "two", false},
+		{"3", "two", false},
+		{"4", "", true},
+		{"Konto", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := book.sheet(tt.name)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want an error %v", err, tt.err)
+			}
+
+			if err == nil && rows[0][0] != tt.want {
+				t.Errorf("got %v, want %v", rows[0][0], tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSheetNumber(t *testing.T) {
+	tests := []struct {
+		value  string
+		config CsvConfig
+		want   string
+	}{
+		{"1234.5", CsvConfig{}, "1234.5"},
+		{"0.30000000000000004", CsvConfig{}, "0.3"},
+		{"1234.5600000000002", CsvConfig{}, "1234.56"},
+		{"123456789012", CsvConfig{}, "123456789012"},
+		{"1E-3", CsvConfig{}, "0.001"},
+		{"-16", CsvConfig{}, "-16"},
+		{"-1234.5", CsvConfig{DecimalSeparator: ","}, "-1234,5"},
+		{"-1234.5", CsvConfig{Locale: "de_DE"}, "-1234,5"},
+		{"-1234.5", CsvConfig{NegativeStyle: NegativeTrailing}, "1234.5-"},
+		{"-1234.5", CsvConfig{NegativeStyle: NegativeParentheses}, "(1234.5)"},
+		{"42", CsvConfig{NegativeStyle: NegativeParentheses}, "42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			ans, err := formatSheetNumber(tt.value, tt.config)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			if ans != tt.want {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+
+	if _, err := formatSheetNumber("abc", CsvConfig{}); err == nil {
+		t.Errorf("got no error for an invalid number")
+	}
+}
+
+func TestSheetReader(t *testing.T) {
+	rows := [][]string{
+		{"Konto", "DE12 3456"},
+		{"Buchung", "Betrag"},
+		{"01.05.2020", "-16"},
+		{"Summe", "-16"},
+	}
+
+	r, header, err := getTableReader(&sheetReader{rows: rows}, CsvConfig{Separator: ';', Skip: 2, StopAt: "^Summe;"})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	if !reflect.DeepEqual(header, rows[1]) {
+		t.Errorf("got header %v, want %v", header, rows[1])
+	}
+
+	if record, err := r.Read(); err != nil || !reflect.DeepEqual(record, rows[2]) {
+		t.Errorf("got %v and %v, want %v", record, err, rows[2])
+	}
+
+	if record, err := r.Read(); err != io.EOF {
+		t.Errorf("got %v and %v, want EOF", record, err)
+	}
+}
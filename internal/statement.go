@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// StatementDateLayout is the layout of the dates in the rows of statements
+const StatementDateLayout = "2006-01-02"
+
+// statement is a bank statement read from a file format other than csv. Its
+// transactions are laid out as rows under a header naming their fields, so
+// they're converted by formatRecord like the rows of a csv file and rules
+// can check any of their fields by name.
+type statement struct {
+	balances  []statementBalance // The balances stated, e.g. the closing balance
+	brokerage *BrokerageConfig   // The trades of an investment statement, the configured accounts taking precedence
+	columns   statementColumns   // The fields the values of the records are taken from
+	currency  string             // The currency of the statement, the configured currency if empty
+	fees      []Fee              // The fee fields, the configured account of a fee of the same field taking precedence
+	header    []string           // The names of the fields of the rows
+	info      map[string]string  // The values describing the statement, e.g. the account number
+	rows      [][]string         // The transactions, amounts and dates already normalized
+}
+
+// statementColumns names the fields of a statement's rows that hold the
+// values of its records
+type statementColumns struct {
+	amount      string // The signed amount field
+	currency    string // The currency field, overriding the statement's currency where it isn't empty
+	date        string // The date field, in the StatementDateLayout
+	description string // The description field
+	group       string // The field of the rows that are merged into one transaction
+	id          string // The unique transaction id field
+	meta        string // The metadata key the transaction id is added as
+	payee       string // The payee field
+}
+
+// statementBalance is a balance stated by a statement
+type statementBalance struct {
+	amount   Decimal   // The balance
+	closing  bool      // Whether it's the balance at the end of the day rather than the start
+	currency string    // The currency, the statement's currency if empty
+	time     time.Time // The day of the balance
+}
+
+// csvConfig returns the config converting the rows of the statement, taking
+// the accounts, commodities, currency and output date layout from the csv
+// config
+func (s statement) csvConfig(config CsvConfig) (CsvConfig, error) {
+	c := CsvConfig{
+		AmountIn:           parseColumn(s.columns.amount),
+		AmountOut:          parseColumn(s.columns.amount),
+		Commodities:        config.Commodities,
+		Currency:           config.Currency,
+		Date:               parseColumn(s.columns.date),
+		DateLayoutIn:       StatementDateLayout,
+		DateLayoutOut:      config.DateLayoutOut,
+		DecimalSeparator:   ".",
+		DefaultAccount:     config.DefaultAccount,
+		Description:        parseColumn(s.columns.description),
+		Payee:              parseColumn(s.columns.payee),
+		ProcessingAccount:  config.ProcessingAccount,
+		ProcessingAccounts: config.ProcessingAccounts,
+		Separator:          config.Separator,
+	}
+
+	if s.currency != "" {
+		c.Currency = s.currency
+	}
+
+	if s.columns.currency != "" {
+		column := parseColumn(s.columns.currency)
+		c.CurrencyColumn = &column
+	}
+
+	if s.columns.group != "" {
+		column := parseColumn(s.columns.group)
+		c.GroupBy = &column
+	}
+
+	if s.brokerage != nil {
+		brokerage := *s.brokerage
+
+		if config.Brokerage != nil {
+			brokerage.Booking = config.Brokerage.Booking
+			brokerage.CashAccount = config.Brokerage.CashAccount
+			brokerage.GainsAccount = config.Brokerage.GainsAccount
+			brokerage.HoldingsAccount = config.Brokerage.HoldingsAccount
+		}
+
+		c.Brokerage = &brokerage
+	}
+
+	for _, fee := range s.fees {
+		for _, configured := range config.Fees {
+			if strings.EqualFold(configured.Column.Name, fee.Column.Name) {
+				fee.Account = configured.Account
+			}
+		}
+
+		c.Fees = append(c.Fees, fee)
+	}
+
+	c, err := c.resolveColumns(s.header)
+	if err != nil {
+		return c, err
+	}
+
+	c.header = s.header
+	c.preamble = s.info
+	c.ProcessingAccount = getProcessingAccount(s.info, c)
+
+	return c, nil
+}
+
+// processStatement converts the transactions of a statement like the rows
+// of a csv file, skipping any whose id was already converted, and asserts
+// the balances it states
+func processStatement(s statement, config Config, template string, output io.Writer) {
+	csvConfig, err := s.csvConfig(config.Csv)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"header": s.header,
+			"error":  err,
+		}).Fatal("error resolving statement fields")
+	}
+
+	rules, err := config.TransactionsRules.resolveColumns(s.header)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"header": s.header,
+			"error":  err,
+		}).Fatal("error resolving condition columns")
+	}
+
+	config.Csv = csvConfig
+	config.TransactionsRules = rules
+
+	id, err := parseColumn(s.columns.id).resolve(s.header)
+	if err != nil {
+		id = Column{Index: -1}
+	}
+
+	ids := make(map[string]bool)
+
+	var records []Record
+
+	for _, row := range s.rows {
+		log.WithFields(log.Fields{
+			"record": row,
+		}).Trace("processing a statement transaction")
+
+		value := strings.TrimSpace(id.value(row))
+		if value != "" && ids[value] {
+			log.WithFields(log.Fields{
+				"id": value,
+			}).Debug("skipping a transaction with an id already converted")
+
+			continue
+		}
+
+		record := formatRecord(row, config)
+
+		if value != "" {
+			ids[value] = true
+
+			if _, ok := record.Meta[s.columns.meta]; !ok {
+				record.Meta[s.columns.meta] = value
+			}
+		}
+
+		records = append(records, record)
+	}
+
+	if config.Csv.Brokerage != nil && config.Csv.Brokerage.Booking == BookingFIFO {
+		bookLots(records)
+	}
+
+	if config.Csv.GroupBy != nil {
+		records = groupRecords(records)
+	}
+
+	for _, balance := range s.balances {
+		if !balance.closing {
+			renderBalance(balance.assertion(config.Csv), output)
+		}
+	}
+
+	for _, record := range records {
+		renderRecord(record, template, output)
+	}
+
+	for _, balance := range s.balances {
+		if balance.closing {
+			renderBalance(balance.assertion(config.Csv), output)
+		}
+	}
+}
+
+// assertion returns the balance assertion of a stated balance, a closing
+// balance being asserted the day after since beancount checks balances at
+// the start of the day
+func (b statementBalance) assertion(config CsvConfig) Balance {
+	currency := b.currency
+	if currency == "" {
+		currency = config.Currency
+	}
+
+	date := b.time
+	if b.closing {
+		date = date.AddDate(0, 0, 1)
+	}
+
+	return Balance{
+		Account:  config.ProcessingAccount,
+		Amount:   b.amount,
+		Currency: currency,
+		Date:     date.Format(config.DateLayoutOut),
+	}
+}
+
+// decodeStatement returns the text of a statement file, which is taken to be
+// in windows-1252 unless it's valid utf-8, as the older text formats mostly
+// are in windows-1252 or its subset latin-1
+func decodeStatement(data []byte) (string, error) {
+	if utf8.Valid(data) {
+		return string(data), nil
+	}
+
+	decoded, err := charmap.Windows1252.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", err
+	}
+
+	return string(decoded), nil
+}
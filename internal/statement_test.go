@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func mustDate(s string) time.Time {
+	t, err := time.Parse(StatementDateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func TestStatementBalanceAssertion(t *testing.T) {
+	config := CsvConfig{Currency: "EUR", DateLayoutOut: "2006-01-02", ProcessingAccount: "Assets:Bank"}
+	day := time.Date(2020, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		balance statementBalance
+		want    Balance
+	}{
+		{
+			"opening",
+			statementBalance{amount: mustDecimal("100.00"), time: day},
+			Balance{Account: "Assets:Bank", Amount: mustDecimal("100.00"), Currency: "EUR", Date: "2020-03-31"},
+		},
+		{
+			"closing",
+			statementBalance{amount: mustDecimal("-5.00"), closing: true, currency: "USD", time: day},
+			Balance{Account: "Assets:Bank", Amount: mustDecimal("-5.00"), Currency: "USD", Date: "2020-04-01"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ans := tt.balance.assertion(config); !reflect.DeepEqual(ans, tt.want) {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatementCsvConfig(t *testing.T) {
+	s := statement{
+		columns:  ofxColumns,
+		currency: "USD",
+		header:   ofxHeader,
+		info:     map[string]string{"account": "1234567890"},
+	}
+
+	config := DefaultConfigExample1.Csv
+	config.ProcessingAccounts = []ProcessingAccountRule{
+		{Preamble: "account", Match: regexp.MustCompile("^1234"), Account: "Assets:Checking"},
+	}
+
+	c, err := s.csvConfig(config)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	if c.AmountIn.Index != 3 || c.Date.Index != 1 || c.Payee.Index != 8 || c.Description.Index != 9 || c.CurrencyColumn.Index != 10 {
+		t.Errorf("got columns %v %v %v %v %v", c.AmountIn, c.Date, c.Payee, c.Description, *c.CurrencyColumn)
+	}
+
+	if c.Currency != "USD" || c.ProcessingAccount != "Assets:Checking" || c.DateLayoutIn != StatementDateLayout {
+		t.Errorf("got currency %v, processing account %v, date layout %v", c.Currency, c.ProcessingAccount, c.DateLayoutIn)
+	}
+}
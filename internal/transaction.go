@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FlagComplete is the flag of a transaction that needs no further review
+const FlagComplete = "*"
+
+// Posting represents a single leg of a transaction
+type Posting struct {
+	Account   string   // The account
+	Amount    *Decimal // The number of units, nil to have beancount interpolate it
+	Commodity string   // The commodity of the units
+	Cost      *Cost    // The cost of the units, if they are held at cost
+	Price     *Price   // The price of the units, if they are converted
+}
+
+// Cost represents the cost specification of a posting
+type Cost struct {
+	Amount    *Decimal // The cost per unit, nil for an empty cost specification
+	Commodity string   // The commodity of the cost
+	Date      string   // The acquisition date of the lot, optional
+	Label     string   // The label of the lot, optional
+}
+
+// Price represents the price annotation of a posting
+type Price struct {
+	Amount    Decimal // The price
+	Commodity string  // The commodity of the price
+	Total     bool    // Whether the price is for all the units, rather than per unit
+}
+
+// String formats the posting as it appears in a transaction, without the
+// indentation, so templates can render it with {{ . }}
+func (p Posting) String() string {
+	if p.Amount == nil {
+		return p.Account
+	}
+
+	parts := []string{fmt.Sprintf("%s  %s %s", p.Account, p.Amount, p.Commodity)}
+
+	if p.Cost != nil {
+		parts = append(parts, p.Cost.String())
+	}
+
+	if p.Price != nil {
+		parts = append(parts, p.Price.String())
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// String formats the cost specification, e.g. {95.12 EUR, 2019-04-26}
+func (c Cost) String() string {
+	var parts []string
+
+	if c.Amount != nil {
+		parts = append(parts, fmt.Sprintf("%s %s", c.Amount, c.Commodity))
+	}
+
+	if c.Date != "" {
+		parts = append(parts, c.Date)
+	}
+
+	if c.Label != "" {
+		parts = append(parts, fmt.Sprintf("%q", c.Label))
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(parts, ", "))
+}
+
+// String formats the price annotation, e.g. @ 1.12 USD or @@ 14.20 GBP
+func (p Price) String() string {
+	if p.Total {
+		return fmt.Sprintf("@@ %s %s", p.Amount, p.Commodity)
+	}
+
+	return fmt.Sprintf("@ %s %s", p.Amount, p.Commodity)
+}
+
+// convertPostings records the other side of a transaction in the original
+// currency, and annotates the processing account's posting with the total
+// price, e.g. -16.00 EUR @@ 14.20 GBP
+func convertPostings(processing, other *Posting, original Decimal, commodity string) {
+	total := original.Abs()
+
+	processing.Price = &Price{Amount: total, Commodity: commodity, Total: true}
+
+	amount := total
+	if other.Amount != nil && other.Amount.Sign() < 0 {
+		amount = total.Neg()
+	}
+
+	other.Amount = &amount
+	other.Commodity = commodity
+}
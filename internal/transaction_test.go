@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestPostingString(t *testing.T) {
+	var tests = []struct {
+		name    string
+		posting Posting
+		want    string
+	}{
+		{
+			"test #1 simple posting",
+			Posting{Account: "Assets:Unknown", Amount: mustDecimalPtr("-16.00"), Commodity: "EUR"},
+			"Assets:Unknown  -16.00 EUR",
+		},
+		{
+			"test #2 interpolated posting",
+			Posting{Account: "Income:Gains"},
+			"Income:Gains",
+		},
+		{
+			"test #3 posting at cost",
+			Posting{Account: "Assets:Broker:VWRL", Amount: mustDecimalPtr("10"), Commodity: "VWRL", Cost: &Cost{Amount: mustDecimalPtr("95.12"), Commodity: "EUR", Date: "2019-04-26", Label: "lot 1"}},
+			`Assets:Broker:VWRL  10 VWRL {95.12 EUR, 2019-04-26, "lot 1"}`,
+		},
+		{
+			"test #4 posting with an empty cost and a price",
+			Posting{Account: "Assets:Broker:VWRL", Amount: mustDecimalPtr("-10"), Commodity: "VWRL", Cost: &Cost{}, Price: &Price{Amount: mustDecimal("100.00"), Commodity: "EUR"}},
+			"Assets:Broker:VWRL  -10 VWRL {} @ 100.00 EUR",
+		},
+		{
+			"test #5 posting with a total price",
+			Posting{Account: "Assets:Unknown", Amount: mustDecimalPtr("-16.00"), Commodity: "EUR", Price: &Price{Amount: mustDecimal("14.20"), Commodity: "GBP", Total: true}},
+			"Assets:Unknown  -16.00 EUR @@ 14.20 GBP",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ans := tt.posting.String(); ans != tt.want {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderRecordPostings(t *testing.T) {
+	tpl, err := ioutil.ReadFile("../examples/example_postings.tpl")
+	if err != nil {
+		t.Fatalf("error reading template: %v", err)
+	}
+
+	record := Record{
+		Date:      "2019-04-23",
+		Flag:      "!",
+		Payee:     "REWE",
+		Narration: "Groceries",
+		Tags:      []string{"food"},
+		Links:     []string{"receipt-42"},
+		Meta:      map[string]string{"category": "groceries", "card": "visa"},
+		Postings: []Posting{
+			{Account: "Assets:Unknown", Amount: mustDecimalPtr("-6.58"), Commodity: "EUR"},
+			{Account: "Expenses:Groceries", Amount: mustDecimalPtr("6.58"), Commodity: "EUR"},
+		},
+	}
+
+	want := `2019-04-23 ! "REWE" "Groceries" #food ^receipt-42
+  card: "visa"
+  category: "groceries"
+  Assets:Unknown  -6.58 EUR
+  Expenses:Groceries  6.58 EUR
+
+`
+
+	buf := new(bytes.Buffer)
+	renderRecord(record, string(tpl), buf)
+	if buf.String() != want {
+		t.Errorf("got %v, want %v", buf.String(), want)
+	}
+}
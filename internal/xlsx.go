@@ -0,0 +1,352 @@
+package internal
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// xlsxDateFormatIds are the built-in number formats showing dates or
+	// times, including those of east asian locales
+	xlsxDateFormatIds = map[int]bool{
+		14: true, 15: true, 16: true, 17: true, 18: true, 19: true, 20: true, 21: true, 22: true,
+		27: true, 28: true, 29: true, 30: true, 31: true, 32: true, 33: true, 34: true, 35: true, 36: true,
+		45: true, 46: true, 47: true,
+		50: true, 51: true, 52: true, 53: true, 54: true, 55: true, 56: true, 57: true, 58: true,
+	}
+	// xlsxFormatLiteral matches the parts of a number format that aren't
+	// placeholders, i.e. quoted text, escaped characters and colours or
+	// locales in brackets
+	xlsxFormatLiteral = regexp.MustCompile(`"[^"]*"|\\.|_.|\*.|\[[^\]]*\]`)
+	// xlsxDatePlaceholder matches the placeholders of a number format
+	// showing dates or times
+	xlsxDatePlaceholder = regexp.MustCompile(`[dDmMyYhHsS]`)
+)
+
+// xlsxWorkbook is the xl/workbook.xml part listing the sheets
+type xlsxWorkbook struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"` // Whether dates count from 1904 rather than 1900
+	} `xml:"workbookPr"` // The properties of the workbook
+	Sheets []xlsxSheet `xml:"sheets>sheet"` // The sheets, in order
+}
+
+// xlsxSheet is a sheet of the workbook
+type xlsxSheet struct {
+	ID   string `xml:"id,attr"`   // The id of the relationship to its part
+	Name string `xml:"name,attr"` // The name
+}
+
+// xlsxRelationships is the xl/_rels/workbook.xml.rels part locating the
+// parts of the sheets
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`     // The id
+		Target string `xml:"Target,attr"` // The part, relative to xl/
+	} `xml:"Relationship"`
+}
+
+// xlsxSharedStrings is the xl/sharedStrings.xml part holding the text of
+// the string cells
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"` // The strings, referenced by their index
+}
+
+// xlsxText is either plain text or rich text made up of runs
+type xlsxText struct {
+	Runs []struct {
+		T string `xml:"t"` // The text of the run
+	} `xml:"r"` // The runs of rich text
+	T string `xml:"t"` // The plain text
+}
+
+// xlsxStyles is the xl/styles.xml part holding the number formats of cells
+type xlsxStyles struct {
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"` // The number format
+	} `xml:"cellXfs>xf"` // The cell formats, referenced by their index
+	NumFmts []struct {
+		Code string `xml:"formatCode,attr"` // The format code, e.g. dd/mm/yyyy
+		ID   int    `xml:"numFmtId,attr"`   // The id
+	} `xml:"numFmts>numFmt"` // The custom number formats
+}
+
+// xlsxWorksheet is the part holding the cells of a sheet
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []xlsxCell `xml:"c"` // The cells holding a value or a format
+	} `xml:"sheetData>row"` // The rows holding any cells
+}
+
+// xlsxCell is a cell of a sheet
+type xlsxCell struct {
+	Inline xlsxText `xml:"is"`     // The text of an inline string
+	Ref    string   `xml:"r,attr"` // The reference, e.g. B2
+	Style  int      `xml:"s,attr"` // The index of the cell format
+	Type   string   `xml:"t,attr"` // The type, a number if empty
+	Value  string   `xml:"v"`      // The value
+}
+
+// ProcessXlsxFile ...
+func ProcessXlsxFile(file io.Reader, config Config, template string) {
+	processXlsxFile(file, config, template, os.Stdout)
+}
+
+// processXlsxFile converts the configured sheet of an xlsx file like a csv
+// file
+func processXlsxFile(file io.Reader, config Config, template string, output io.Writer) {
+	config.Csv = spreadsheetConfig(config.Csv)
+
+	book, err := readXlsx(file, config.Csv)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("error reading xlsx file")
+	}
+
+	processSpreadsheet(book, config, template, output)
+}
+
+// readXlsx reads the sheets of an xlsx file. Numbers are taken from the
+// values of the cells rather than from how they're displayed, and numbers
+// formatted as dates, which are days since the end of 1899, are written in
+// the date layout.
+func readXlsx(file io.Reader, config CsvConfig) (spreadsheet, error) {
+	var book spreadsheet
+
+	archive, err := openZip(file)
+	if err != nil {
+		return book, err
+	}
+
+	var workbook xlsxWorkbook
+	if err := readXlsxPart(archive, "xl/workbook.xml", &workbook); err != nil {
+		return book, err
+	}
+
+	var relationships xlsxRelationships
+	if err := readXlsxPart(archive, "xl/_rels/workbook.xml.rels", &relationships); err != nil {
+		return book, err
+	}
+
+	var shared xlsxSharedStrings
+	if err := readXlsxPart(archive, "xl/sharedStrings.xml", &shared); err != nil {
+		return book, err
+	}
+
+	var styles xlsxStyles
+	if err := readXlsxPart(archive, "xl/styles.xml", &styles); err != nil {
+		return book, err
+	}
+
+	// the cell formats showing dates, by their index
+	dates := make([]bool, len(styles.CellXfs))
+	for i, xf := range styles.CellXfs {
+		dates[i] = xlsxDateFormatIds[xf.NumFmtID]
+
+		for _, format := range styles.NumFmts {
+			if format.ID == xf.NumFmtID {
+				dates[i] = isXlsxDateFormat(format.Code)
+			}
+		}
+	}
+
+	for _, sheet := range workbook.Sheets {
+		var target string
+		for _, relationship := range relationships.Relationships {
+			if relationship.ID == sheet.ID {
+				target = relationship.Target
+			}
+		}
+
+		if target == "" {
+			return book, fmt.Errorf("no part found for sheet %q", sheet.Name)
+		}
+
+		if path.IsAbs(target) {
+			target = target[1:]
+		} else {
+			target = path.Join("xl", target)
+		}
+
+		var worksheet xlsxWorksheet
+		if err := readXlsxPart(archive, target, &worksheet); err != nil {
+			return book, err
+		}
+
+		var rows [][]string
+
+		for _, r := range worksheet.Rows {
+			var row []string
+
+			for _, cell := range r.Cells {
+				value, err := cell.text(shared, dates, workbook.Properties.Date1904, config)
+				if err != nil {
+					return book, fmt.Errorf("sheet %q cell %s: %v", sheet.Name, cell.Ref, err)
+				}
+
+				column := len(row)
+				if cell.Ref != "" {
+					if column, err = xlsxColumn(cell.Ref); err != nil {
+						return book, fmt.Errorf("sheet %q: %v", sheet.Name, err)
+					}
+				}
+
+				for len(row) <= column {
+					row = append(row, "")
+				}
+
+				row[column] = value
+			}
+
+			if row = sheetRow(row); row != nil {
+				rows = append(rows, row)
+			}
+		}
+
+		book.names = append(book.names, sheet.Name)
+		book.sheets = append(book.sheets, rows)
+	}
+
+	return book, nil
+}
+
+// readXlsxPart unmarshals a part of an xlsx file, leaving the value as it
+// is if there's no such part
+func readXlsxPart(archive *zip.Reader, name string, v interface{}) error {
+	data, err := readZipFile(archive, name)
+	if err != nil || data == nil {
+		return err
+	}
+
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+
+	return nil
+}
+
+// text returns the value of a cell as it's written into the row
+func (c xlsxCell) text(shared xlsxSharedStrings, dates []bool, date1904 bool, config CsvConfig) (string, error) {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(shared.Items) {
+			return "", fmt.Errorf("invalid shared string %q", c.Value)
+		}
+
+		return shared.Items[i].text(), nil
+	case "inlineStr":
+		return c.Inline.text(), nil
+	case "str", "e":
+		return c.Value, nil
+	case "b":
+		if c.Value == "1" {
+			return "TRUE", nil
+		}
+
+		return "FALSE", nil
+	case "d":
+		t, err := parseXlsxISODate(c.Value)
+		if err != nil {
+			return "", err
+		}
+
+		return formatSheetDate(t, config), nil
+	}
+
+	if c.Value == "" {
+		return "", nil
+	}
+
+	if c.Style >= 0 && c.Style < len(dates) && dates[c.Style] {
+		serial, err := strconv.ParseFloat(c.Value, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid date %q", c.Value)
+		}
+
+		return formatSheetDate(xlsxDate(serial, date1904), config), nil
+	}
+
+	return formatSheetNumber(c.Value, config)
+}
+
+// text returns the text of plain or rich text
+func (t xlsxText) text() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+
+	var runs []string
+	for _, run := range t.Runs {
+		runs = append(runs, run.T)
+	}
+
+	return strings.Join(runs, "")
+}
+
+// isXlsxDateFormat reports whether a custom number format shows a date or
+// a time
+func isXlsxDateFormat(code string) bool {
+	return xlsxDatePlaceholder.MatchString(xlsxFormatLiteral.ReplaceAllString(code, ""))
+}
+
+// xlsxColumn returns the index of the column of a cell reference, e.g. 1
+// for B2
+func xlsxColumn(ref string) (int, error) {
+	column := 0
+
+	for i, r := range ref {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			column = column*26 + int(r-'A') + 1
+		case r >= 'a' && r <= 'z':
+			column = column*26 + int(r-'a') + 1
+		case i == 0:
+			return 0, fmt.Errorf("invalid cell reference %q", ref)
+		default:
+			return column - 1, nil
+		}
+	}
+
+	return column - 1, nil
+}
+
+// xlsxDate returns the time of a date serial number, the days since
+// 1899-12-30 (which makes up for 1900 wrongly being taken as a leap year), or
+// since 1904-01-01 in the 1904 date system, the fraction being the time of
+// day
+func xlsxDate(serial float64, date1904 bool) time.Time {
+	epoch := time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 24 * 60 * 60)
+
+	return epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+}
+
+// parseXlsxISODate parses the value of a date cell, which is an ISO 8601
+// date and time
+func parseXlsxISODate(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02", "15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
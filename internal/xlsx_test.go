@@ -0,0 +1,268 @@
+package internal
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// xlsxFiles are the parts of an xlsx file with an info sheet and a sheet
+// of transactions, its dates formatted both with a built-in and a custom
+// date format
+var xlsxFiles = map[string]string{
+	"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<workbookPr/>
+<sheets>
+<sheet name="Info" sheetId="1" r:id="rId1"/>
+<sheet name="Umsätze" sheetId="2" r:id="rId2"/>
+</sheets>
+</workbook>`,
+	"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`,
+	"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="9" uniqueCount="9">
+<si><t>Konto</t></si>
+<si><t>Buchung</t></si>
+<si><t>Auftraggeber/Empfänger</t></si>
+<si><t>Verwendungszweck</t></si>
+<si><t>Betrag</t></si>
+<si><t>Acme Corp GmbH</t></si>
+<si><r><t>LOHN / </t></r><r><rPr><b/></rPr><t>GEHALT 04/19</t></r></si>
+<si><t>VISA RYANAIR</t></si>
+<si><t>Summe</t></si>
+</sst>`,
+	"xl/styles.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2">
+<numFmt numFmtId="164" formatCode="dd/mm/yyyy"/>
+<numFmt numFmtId="165" formatCode="#,##0.00\ &quot;€&quot;;[Red]\-#,##0.00\ &quot;€&quot;"/>
+</numFmts>
+<cellXfs count="4">
+<xf numFmtId="0"/>
+<xf numFmtId="14"/>
+<xf numFmtId="164"/>
+<xf numFmtId="165"/>
+</cellXfs>
+</styleSheet>`,
+	"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetData>
+<row r="1"><c r="A1" t="inlineStr"><is><t>Export</t></is></c><c r="B1" t="b"><v>1</v></c></row>
+</sheetData>
+</worksheet>`,
+	"xl/worksheets/sheet2.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1"><v>1234567890</v></c></row>
+<row r="2"><c r="A2" s="3"/><c r="B2" s="3"/></row>
+<row r="3"><c r="A3" t="s"><v>1</v></c><c r="B3" t="s"><v>2</v></c><c r="C3" t="s"><v>3</v></c><c r="D3" t="s"><v>4</v></c></row>
+<row r="4"><c r="A4" s="1"><v>43581</v></c><c r="B4" t="s"><v>5</v></c><c r="C4" t="s"><v>6</v></c><c r="D4" s="3"><v>3784.2199999999998</v></c></row>
+<row r="5"><c r="A5" s="2"><v>43579.5</v></c><c r="B5" t="s"><v>7</v></c><c r="D5" s="3"><v>-16</v></c></row>
+<row r="6"><c r="A6" t="s"><v>8</v></c><c r="D6" t="str"><f>SUM(D4:D5)</f><v>3768.22</v></c></row>
+</sheetData>
+</worksheet>`,
+}
+
+func TestReadXlsx(t *testing.T) {
+	tests := []struct {
+		name   string
+		config CsvConfig
+		want   spreadsheet
+	}{
+		{
+			"iso dates",
+			CsvConfig{DateLayoutIn: StatementDateLayout},
+			spreadsheet{
+				names: []string{"Info", "Umsätze"},
+				sheets: [][][]string{
+					{{"Export", "TRUE"}},
+					{
+						{"Konto", "1234567890"},
+						{"Buchung", "Auftraggeber/Empfänger", "Verwendungszweck", "Betrag"},
+						{"2019-04-26", "Acme Corp GmbH", "LOHN / GEHALT 04/19", "3784.22"},
+						{"2019-04-24", "VISA RYANAIR", "", "-16"},
+						{"Summe", "", "", "3768.22"},
+					},
+				},
+			},
+		},
+		{
+			"german dates and amounts",
+			CsvConfig{DateLayoutIn: "02.01.2006", Locale: "de_DE"},
+			spreadsheet{
+				names: []string{"Info", "Umsätze"},
+				sheets: [][][]string{
+					{{"Export", "TRUE"}},
+					{
+						{"Konto", "1234567890"},
+						{"Buchung", "Auftraggeber/Empfänger", "Verwendungszweck", "Betrag"},
+						{"26.04.2019", "Acme Corp GmbH", "LOHN / GEHALT 04/19", "3784,22"},
+						{"24.04.2019", "VISA RYANAIR", "", "-16"},
+						{"Summe", "", "", "3768.22"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ans, err := readXlsx(zipFile(t, xlsxFiles), tt.config)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+
+			if !reflect.DeepEqual(ans, tt.want) {
+				t.Errorf("got %q, want %q", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadXlsxErrors(t *testing.T) {
+	invalid := make(map[string]string)
+	for name, content := range xlsxFiles {
+		invalid[name] = content
+	}
+
+	invalid["xl/worksheets/sheet1.xml"] = `<worksheet><sheetData><row><c t="s"><v>42</v></c></row></sheetData></worksheet>`
+
+	if _, err := readXlsx(zipFile(t, invalid), CsvConfig{}); err == nil {
+		t.Errorf("got no error for a missing shared string")
+	}
+
+	if _, err := readXlsx(bytes.NewReader([]byte("Buchung;Betrag")), CsvConfig{}); err == nil {
+		t.Errorf("got no error for a csv file")
+	}
+}
+
+func TestIsXlsxDateFormat(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"dd/mm/yyyy", true},
+		{"[$-407]DD.MM.YYYY;@", true},
+		{"h:mm AM/PM", true},
+		{"General", false},
+		{"#,##0.00\\ \"€\";[Red]\\-#,##0.00\\ \"€\"", false},
+		{"0.00\" days\"", false},
+		{"0.00E+00", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if ans := isXlsxDateFormat(tt.code); ans != tt.want {
+				t.Errorf("got %v, want %v", ans, tt.want)
+			}
+		})
+	}
+}
+
+func TestXlsxDate(t *testing.T) {
+	tests := []struct {
+		serial   float64
+		date1904 bool
+		want     time.Time
+	}{
+		{43581, false, time.Date(2019, time.April, 26, 0, 0, 0, 0, time.UTC)},
+		{43579.5, false, time.Date(2019, time.April, 24, 12, 0, 0, 0, time.UTC)},
+		{42119, true, time.Date(2019, time.April, 26, 0, 0, 0, 0, time.UTC)},
+		{61, false, time.Date(1900, time.March, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if ans := xlsxDate(tt.serial, tt.date1904); !ans.Equal(tt.want) {
+			t.Errorf("got %v for %v, want %v", ans, tt.serial, tt.want)
+		}
+	}
+}
+
+func TestXlsxColumn(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want int
+	}{
+		{"A1", 0},
+		{"D12", 3},
+		{"Z3", 25},
+		{"AA3", 26},
+		{"AB1048576", 27},
+	}
+
+	for _, tt := range tests {
+		ans, err := xlsxColumn(tt.ref)
+		if err != nil || ans != tt.want {
+			t.Errorf("got %v and %v for %v, want %v", ans, err, tt.ref, tt.want)
+		}
+	}
+
+	if _, err := xlsxColumn("1A"); err == nil {
+		t.Errorf("got no error for an invalid reference")
+	}
+}
+
+func TestProcessXlsxFile(t *testing.T) {
+	config := DefaultConfigExample1
+	config.Csv.AmountIn = Column{Index: -1, Name: "Betrag"}
+	config.Csv.AmountOut = Column{Index: -1, Name: "Betrag"}
+	config.Csv.Date = Column{Index: -1, Name: "Buchung"}
+	config.Csv.Description = Column{Index: -1, Name: "Verwendungszweck"}
+	config.Csv.Payee = Column{Index: -1, Name: "Auftraggeber/Empfänger"}
+	config.Csv.Preamble = map[string]*regexp.Regexp{"account": regexp.MustCompile(`^Konto;(\d+)`)}
+	config.Csv.ProcessingAccounts = []ProcessingAccountRule{{Preamble: "account", Match: regexp.MustCompile("^1234567890$"), Account: "Assets:Girokonto"}}
+	config.Csv.Sheet = "Umsätze"
+	config.Csv.Skip = 0
+	config.Csv.SkipUntil = "^Buchung;"
+	config.Csv.StopAt = "^Summe;"
+	config.TransactionsRules = TransactionsRulesConfig{
+		TransactionRule{Name: "salary", MatchDescription: "GEHALT", SetAccount: "Income:Salary"},
+	}
+
+	want := `2019-04-26 "Acme Corp GmbH" "LOHN / GEHALT 04/19"
+  Income:Salary  -3784.22 EUR
+  Assets:Girokonto  3784.22 EUR
+2019-04-24 "VISA RYANAIR" ""
+  Assets:Girokonto  -16 EUR
+  Expenses:Unknown  16 EUR
+`
+
+	// amounts held as text have their decimal separator detected
+	textFiles := make(map[string]string)
+	for name, content := range xlsxFiles {
+		textFiles[name] = content
+	}
+
+	textFiles["xl/worksheets/sheet2.xml"] = strings.NewReplacer(
+		`<c r="D4" s="3"><v>3784.2199999999998</v></c>`, `<c r="D4" t="inlineStr"><is><t>3.784,22</t></is></c>`,
+		`<c r="D5" s="3"><v>-16</v></c>`, `<c r="D5" t="inlineStr"><is><t>-16,00</t></is></c>`,
+	).Replace(xlsxFiles["xl/worksheets/sheet2.xml"])
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"numbers", xlsxFiles, want},
+		{"text", textFiles, strings.Replace(want, "-16 EUR\n  Expenses:Unknown  16 EUR", "-16.00 EUR\n  Expenses:Unknown  16.00 EUR", 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			processXlsxFile(zipFile(t, tt.files), config, "{{.Date}} {{printf \"%q\" .Payee}} {{printf \"%q\" .Narration}}{{range .Postings}}\n  {{.}}{{end}}\n", buf)
+
+			if buf.String() != tt.want {
+				t.Errorf("got %v, want %v", buf.String(), tt.want)
+			}
+		})
+	}
+}